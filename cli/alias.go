@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// aliasesFile lists the names sd can be linked as, under the home source
+const aliasesFile = ".aliases"
+
+func aliasesPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".sd", aliasesFile)
+}
+
+/*
+ * readAliases reads the mapping of aliases to the commands they're scoped to,
+ * one per line, as in:
+ *
+ *   # alias  command
+ *   ops      ops
+ *   infra    ops infra
+ *   tools
+ *
+ * An alias without a command gets everything, like sd itself does.
+ */
+func readAliases(path string) map[string][]string {
+	aliases := map[string][]string{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return aliases
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		aliases[fields[0]] = fields[1:]
+	}
+	if err := scanner.Err(); err != nil {
+		logrus.Debug("Error reading aliases: ", err)
+	}
+	return aliases
+}
+
+/*
+ * binaryAlias tells whether sd was invoked under another name, busybox-style,
+ * and what command that name is scoped to. That's the case when the name is
+ * in the aliases file, or sd was run through a symlink or hardlink to it.
+ */
+func binaryAlias(arg0 string, aliases map[string][]string) (string, []string, bool) {
+	name := filepath.Base(arg0)
+	if arg0 == "" || name == "sd" || strings.HasPrefix(name, "-") {
+		return "", nil, false
+	}
+
+	if scope, ok := aliases[name]; ok {
+		return name, scope, true
+	}
+	if linkedAs(arg0, name) {
+		return name, nil, true
+	}
+	return "", nil, false
+}
+
+/*
+ * linkedAs tells whether arg0 is a link to a binary with another name. A
+ * hardlink can't be told apart from the binary it links to, so any named
+ * differently from sd counts.
+ */
+func linkedAs(arg0 string, name string) bool {
+	path := arg0
+	if !strings.Contains(arg0, string(filepath.Separator)) {
+		found, err := exec.LookPath(arg0)
+		if err != nil {
+			return false
+		}
+		path = found
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(path)
+		return err == nil && filepath.Base(target) != name
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Nlink > 1
+	}
+	return false
+}
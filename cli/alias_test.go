@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAliases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-read-aliases")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, aliasesFile)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("# alias  command\nops      ops\ninfra    ops infra\n\ntools\n"), 0644))
+
+	assert.Equal(t, map[string][]string{
+		"ops":   {"ops"},
+		"infra": {"ops", "infra"},
+		"tools": {},
+	}, readAliases(path))
+
+	assert.Empty(t, readAliases(filepath.Join(dir, "missing")))
+}
+
+func TestBinaryAlias(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-binary-alias")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	bin := writeScript(t, dir, "sd", "binary")
+	assert.NoError(t, os.Symlink(bin, filepath.Join(dir, "ops")))
+	assert.NoError(t, os.Link(bin, filepath.Join(dir, "infra")))
+	writeScript(t, dir, "copy", "binary")
+
+	aliases := map[string][]string{"team": {"team"}}
+
+	var tests = []struct {
+		name     string
+		arg0     string
+		alias    string
+		scope    []string
+		expected bool
+	}{
+		{"sd itself", bin, "", nil, false},
+		{"symlink", filepath.Join(dir, "ops"), "ops", nil, true},
+		{"hardlink", filepath.Join(dir, "infra"), "infra", nil, true},
+		{"copy", filepath.Join(dir, "copy"), "", nil, false},
+		{"in the aliases file", "/usr/local/bin/team", "team", []string{"team"}, true},
+		{"not found", "/does/not/exist", "", nil, false},
+		{"flag", "--alias", "", nil, false},
+		{"empty", "", "", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alias, scope, ok := binaryAlias(test.arg0, aliases)
+			assert.Equal(t, test.expected, ok)
+			assert.Equal(t, test.alias, alias)
+			assert.Equal(t, test.scope, scope)
+		})
+	}
+}
+
+func TestScopedLoading(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-scoped-loading")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	restore, restorePath, args := os.Getenv("HOME"), os.Getenv("SD_PATH"), os.Args
+	defer func() {
+		os.Setenv("HOME", restore)
+		os.Setenv("SD_PATH", restorePath)
+		os.Args = args
+	}()
+	os.Setenv("HOME", dir)
+	os.Setenv("SD_PATH", "")
+	os.Args = []string{"ops"}
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, ".sd", "ops"), 0755))
+	writeScript(t, filepath.Join(dir, ".sd"), "top", "#!/bin/sh\n# top: Top level.\n")
+	writeScript(t, filepath.Join(dir, ".sd", "ops"), "deploy", "#!/bin/sh\n# deploy: Deploys things.\n")
+
+	s := &sd{root: &cobra.Command{Use: "ops"}, noCache: true, scope: []string{"ops"}}
+	assert.NoError(t, s.loadCommands())
+
+	assert.NotNil(t, findChild(s.root, "deploy"))
+	assert.Nil(t, findChild(s.root, "top"))
+	assert.Equal(t, filepath.Join(dir, ".sd"), findChild(s.root, "deploy").Annotations["Root"])
+
+	t.Run("takes help from the README", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".sd", "ops", "README"), []byte("Ops tools.\n\nMore about them.\n"), 0644))
+
+		s := &sd{root: &cobra.Command{Use: "ops"}, noCache: true, scope: []string{"ops"}}
+		assert.NoError(t, s.loadCommands())
+		assert.Equal(t, "Ops tools.", s.root.Short)
+		assert.Contains(t, s.root.Long, "More about them.")
+	})
+
+	t.Run("rejects hidden directories", func(t *testing.T) {
+		s := &sd{root: &cobra.Command{Use: "ops"}, noCache: true, scope: []string{"..", "etc"}}
+		assert.Error(t, s.loadCommands())
+	})
+
+	t.Run("rejects missing directories", func(t *testing.T) {
+		s := &sd{root: &cobra.Command{Use: "ops"}, noCache: true, scope: []string{"nosuch"}}
+		err := s.loadCommands()
+		assert.EqualError(t, err, `no such root "nosuch"`)
+		assert.Equal(t, ExitUsage, ExitCode(err))
+
+		s = &sd{root: &cobra.Command{Use: "ops"}, noCache: true, scope: []string{"ops", "deploy"}}
+		assert.EqualError(t, s.loadCommands(), `no such root "ops deploy"`)
+	})
+}
@@ -0,0 +1,281 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// cacheVersion gets bumped whenever the format of the cache file changes
+const cacheVersion = 9
+
+/*
+ * cache keeps what was parsed out of scripts and READMEs between runs, along
+ * with the listings of the directories they're in, so that sd doesn't need
+ * to read every directory and file in every source on every call. Entries
+ * are keyed on the path of the file or directory, and are only used while
+ * its modification time and size stay the same.
+ */
+type cache struct {
+	path   string
+	dirty  bool
+	used   map[string]bool
+	listed map[string][]os.FileInfo
+
+	Version int                    `json:"version"`
+	SD      string                 `json:"sd"`
+	Entries map[string]*cacheEntry `json:"entries"`
+}
+
+type cacheEntry struct {
+	ModTime int64       `json:"mtime"`
+	Size    int64       `json:"size"`
+	Meta    *ScriptMeta `json:"meta,omitempty"`
+	Text    string      `json:"text,omitempty"`
+	Names   []string    `json:"names,omitempty"`
+}
+
+/*
+ * cacheDir is where sd keeps its caches, following the XDG base directory spec
+ */
+func cacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "sd")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".cache", "sd")
+}
+
+func cachePath() string {
+	return filepath.Join(cacheDir(), "commands.json")
+}
+
+/*
+ * loadCache reads the cache at the given path, starting afresh if it's
+ * missing, unreadable or was written by a different version of sd
+ */
+func loadCache(path string, version string) *cache {
+	fresh := &cache{
+		path:    path,
+		used:    map[string]bool{},
+		listed:  map[string][]os.FileInfo{},
+		Version: cacheVersion,
+		SD:      version,
+		Entries: map[string]*cacheEntry{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logrus.Debug("No cache loaded: ", err)
+		return fresh
+	}
+
+	c := &cache{}
+	if err := json.Unmarshal(data, c); err != nil {
+		logrus.Debug("Ignoring corrupt cache at ", path, ": ", err)
+		return fresh
+	}
+	if c.Version != cacheVersion || c.SD != version || c.Entries == nil {
+		logrus.Debug("Ignoring cache from a different version of sd at: ", path)
+		fresh.dirty = true
+		return fresh
+	}
+
+	logrus.Debug("Loaded ", len(c.Entries), " cache entries from: ", path)
+	c.path = path
+	c.used = map[string]bool{}
+	c.listed = map[string][]os.FileInfo{}
+	return c
+}
+
+/*
+ * lookup returns the entry for path if it's still valid, and nil otherwise
+ */
+func (c *cache) lookup(path string, info os.FileInfo) *cacheEntry {
+	if c == nil {
+		return nil
+	}
+	c.used[path] = true
+
+	e, ok := c.Entries[path]
+	if !ok || e.ModTime != info.ModTime().UnixNano() || e.Size != info.Size() {
+		return nil
+	}
+	logrus.Debug("Cache hit: ", path)
+	return e
+}
+
+func (c *cache) store(path string, info os.FileInfo, e *cacheEntry) {
+	if c == nil {
+		return
+	}
+	e.ModTime = info.ModTime().UnixNano()
+	e.Size = info.Size()
+	c.Entries[path] = e
+	c.dirty = true
+}
+
+/*
+ * meta returns the parsed header of the script at path, reading it only if
+ * it's not cached or has changed since
+ */
+func (c *cache) meta(path string, info os.FileInfo) (*ScriptMeta, error) {
+	// symlinks are checked against what they point to
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		info = target
+	}
+
+	if e := c.lookup(path, info); e != nil && e.Meta != nil {
+		return e.Meta, nil
+	}
+
+	m, err := parseHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	c.store(path, info, &cacheEntry{Meta: m})
+	return m, nil
+}
+
+/*
+ * list returns the entries in the directory at path, sorted by name like
+ * ioutil.ReadDir does. The names in it are only read again when the
+ * directory has changed, but each entry is always looked at afresh, as
+ * changes to the files in it don't change the directory itself.
+ */
+func (c *cache) list(path string) ([]os.FileInfo, error) {
+	if c == nil {
+		return ioutil.ReadDir(path)
+	}
+	if items, ok := c.listed[path]; ok {
+		return items, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []os.FileInfo
+	if e := c.lookup(path, info); e != nil && e.Meta == nil && e.Text == "" {
+		for _, name := range e.Names {
+			item, err := os.Lstat(filepath.Join(path, name))
+			if err != nil {
+				logrus.Debug("Ignoring entry gone from cached listing: ", err)
+				continue
+			}
+			items = append(items, item)
+		}
+	} else {
+		if items, err = ioutil.ReadDir(path); err != nil {
+			return nil, err
+		}
+		e := &cacheEntry{}
+		for _, i := range items {
+			e.Names = append(e.Names, i.Name())
+		}
+		c.store(path, info, e)
+	}
+
+	c.listed[path] = items
+	return items, nil
+}
+
+/*
+ * readme returns the contents of the README at path, reading it only if it's
+ * not cached or has changed since
+ */
+func (c *cache) readme(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return c.text(path, info)
+}
+
+/*
+ * readmeIn returns the contents of the README in the directory at path,
+ * going by its listing rather than looking for the file
+ */
+func (c *cache) readmeIn(path string) (string, error) {
+	readme := filepath.Join(path, "README")
+	if c == nil {
+		return c.readme(readme)
+	}
+
+	items, err := c.list(path)
+	if err != nil {
+		return "", err
+	}
+	for _, i := range items {
+		switch {
+		case i.Name() != "README":
+			continue
+		case i.Mode().IsRegular():
+			return c.text(readme, i)
+		default:
+			return c.readme(readme)
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+func (c *cache) text(path string, info os.FileInfo) (string, error) {
+	if e := c.lookup(path, info); e != nil {
+		return e.Text, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	c.store(path, info, &cacheEntry{Text: string(data)})
+	return string(data), nil
+}
+
+/*
+ * save writes the cache back to disk if anything changed. When prune is set,
+ * which should only be the case after visiting every source in full, entries
+ * for files that weren't seen in this run get dropped.
+ */
+func (c *cache) save(prune bool) error {
+	if c == nil {
+		return nil
+	}
+
+	for path := range c.Entries {
+		if prune && !c.used[path] {
+			delete(c.Entries, path)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debug("Saving ", len(c.Entries), " cache entries to: ", c.path)
+	c.dirty = false
+	return writeFileAtomic(c.path, data)
+}
+
+/*
+ * clearCache removes the cache from disk
+ */
+func clearCache(path string) error {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
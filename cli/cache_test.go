@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheDir(t *testing.T) {
+	restore := os.Getenv("XDG_CACHE_HOME")
+	defer os.Setenv("XDG_CACHE_HOME", restore)
+
+	t.Run("uses XDG_CACHE_HOME", func(t *testing.T) {
+		os.Setenv("XDG_CACHE_HOME", "/tmp/xdg")
+		assert.Equal(t, "/tmp/xdg/sd", cacheDir())
+	})
+
+	t.Run("defaults to ~/.cache", func(t *testing.T) {
+		os.Setenv("XDG_CACHE_HOME", "")
+		assert.Equal(t, filepath.Join(os.Getenv("HOME"), ".cache", "sd"), cacheDir())
+	})
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "foo")
+	assert.NoError(t, ioutil.WriteFile(script, []byte("# foo: first\n"), 0755))
+	readme := filepath.Join(dir, "README")
+	assert.NoError(t, ioutil.WriteFile(readme, []byte("Some readme\n"), 0644))
+
+	path := filepath.Join(dir, "cache", "commands.json")
+
+	t.Run("parses and saves on a miss", func(t *testing.T) {
+		c := loadCache(path, "1.0")
+		info, err := os.Lstat(script)
+		assert.NoError(t, err)
+
+		m, err := c.meta(script, info)
+		assert.NoError(t, err)
+		assert.Equal(t, "first", m.Short)
+
+		text, err := c.readme(readme)
+		assert.NoError(t, err)
+		assert.Equal(t, "Some readme\n", text)
+
+		assert.NoError(t, c.save(true))
+		assert.FileExists(t, path)
+	})
+
+	t.Run("uses cached entries while files are unchanged", func(t *testing.T) {
+		c := loadCache(path, "1.0")
+		assert.Len(t, c.Entries, 2)
+
+		// changing the cached entry proves it's what gets returned
+		c.Entries[script].Meta.Short = "from cache"
+
+		info, err := os.Lstat(script)
+		assert.NoError(t, err)
+		m, err := c.meta(script, info)
+		assert.NoError(t, err)
+		assert.Equal(t, "from cache", m.Short)
+	})
+
+	t.Run("invalidates entries when files change", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(script, []byte("# foo: second, and longer\n"), 0755))
+		later := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(script, later, later))
+
+		c := loadCache(path, "1.0")
+		info, err := os.Lstat(script)
+		assert.NoError(t, err)
+		m, err := c.meta(script, info)
+		assert.NoError(t, err)
+		assert.Equal(t, "second, and longer", m.Short)
+	})
+
+	t.Run("drops entries that weren't used", func(t *testing.T) {
+		c := loadCache(path, "1.0")
+		_, err := c.readme(readme)
+		assert.NoError(t, err)
+		assert.NoError(t, c.save(true))
+
+		c = loadCache(path, "1.0")
+		assert.Len(t, c.Entries, 1)
+		assert.Contains(t, c.Entries, readme)
+	})
+
+	t.Run("ignores caches from other versions", func(t *testing.T) {
+		c := loadCache(path, "2.0")
+		assert.Empty(t, c.Entries)
+	})
+
+	t.Run("ignores corrupt caches", func(t *testing.T) {
+		corrupt := filepath.Join(dir, "corrupt.json")
+		assert.NoError(t, ioutil.WriteFile(corrupt, []byte("{"), 0644))
+
+		c := loadCache(corrupt, "1.0")
+		assert.Empty(t, c.Entries)
+	})
+
+	t.Run("works without a cache", func(t *testing.T) {
+		var c *cache
+		info, err := os.Lstat(script)
+		assert.NoError(t, err)
+
+		m, err := c.meta(script, info)
+		assert.NoError(t, err)
+		assert.Equal(t, "second, and longer", m.Short)
+		assert.NoError(t, c.save(true))
+	})
+
+	t.Run("clears", func(t *testing.T) {
+		assert.NoError(t, clearCache(path))
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+
+		assert.NoError(t, clearCache(path))
+	})
+}
+
+func TestCacheListings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-cache-listings")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "deploy"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "deploy", "README"), []byte("Deploys\n"), 0644))
+	script := writeScript(t, filepath.Join(src, "deploy"), "web", "#!/bin/sh\n# web: first\n")
+
+	path := filepath.Join(dir, "cache", "commands.json")
+	load := func(focus []string) *cobra.Command {
+		c := loadCache(path, "1.0")
+		cmds, err := visitDir(c, src, focus)
+		assert.NoError(t, err)
+		assert.NoError(t, c.save(len(focus) == 0))
+
+		root := &cobra.Command{Use: "sd"}
+		root.AddCommand(cmds...)
+		return root
+	}
+
+	deploy, _, _ := load(nil).Find([]string{"deploy"})
+	assert.Equal(t, "Deploys", deploy.Short)
+
+	t.Run("doesn't read unchanged directories", func(t *testing.T) {
+		c := loadCache(path, "1.0")
+		assert.Equal(t, []string{"deploy"}, c.Entries[src].Names)
+
+		// changing the cached listing proves it's what gets used
+		c.Entries[filepath.Join(src, "deploy")].Names = []string{"README"}
+		items, err := c.list(filepath.Join(src, "deploy"))
+		assert.NoError(t, err)
+		assert.Len(t, items, 1)
+	})
+
+	t.Run("reads directories again when they change", func(t *testing.T) {
+		writeScript(t, filepath.Join(src, "deploy"), "db", "#!/bin/sh\n# db: Deploys the database\n")
+		later := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "deploy"), later, later))
+
+		db, _, _ := load(nil).Find([]string{"deploy", "db"})
+		assert.Equal(t, "Deploys the database", db.Short)
+	})
+
+	t.Run("notices scripts changed in place", func(t *testing.T) {
+		assert.NoError(t, ioutil.WriteFile(script, []byte("#!/bin/sh\n# web: second, and longer\n"), 0755))
+		later := time.Now().Add(2 * time.Minute)
+		assert.NoError(t, os.Chtimes(script, later, later))
+
+		web, _, _ := load([]string{"deploy", "web"}).Find([]string{"deploy", "web"})
+		assert.Equal(t, "second, and longer", web.Short)
+
+		web, _, _ = load(nil).Find([]string{"deploy", "web"})
+		assert.Equal(t, "second, and longer", web.Short)
+	})
+
+	t.Run("notices scripts made executable", func(t *testing.T) {
+		api := filepath.Join(src, "deploy", "api")
+		assert.NoError(t, ioutil.WriteFile(api, []byte("#!/bin/sh\n# api: Deploys the API\n"), 0644))
+		later := time.Now().Add(3 * time.Minute)
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "deploy"), later, later))
+
+		cmd, _, _ := load(nil).Find([]string{"deploy", "api"})
+		assert.Equal(t, "deploy", cmd.Name())
+
+		assert.NoError(t, os.Chmod(api, 0755))
+		cmd, _, _ = load([]string{"deploy", "api"}).Find([]string{"deploy", "api"})
+		assert.Equal(t, "Deploys the API", cmd.Short)
+	})
+
+	t.Run("notices READMEs changed in place", func(t *testing.T) {
+		readme := filepath.Join(src, "deploy", "README")
+		assert.NoError(t, ioutil.WriteFile(readme, []byte("Deploys things\n"), 0644))
+		later := time.Now().Add(4 * time.Minute)
+		assert.NoError(t, os.Chtimes(readme, later, later))
+
+		deploy, _, _ := load(nil).Find([]string{"deploy"})
+		assert.Equal(t, "Deploys things", deploy.Short)
+	})
+}
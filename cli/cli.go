@@ -1,15 +1,18 @@
 package cli
 
 import (
+	"bufio"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // SD is the main interface to running sd
@@ -19,7 +22,10 @@ type SD interface {
 
 type sd struct {
 	root        *cobra.Command
+	version     string
+	noCache     bool
 	initialized bool
+	scope       []string
 }
 
 // New returns an instance of SD
@@ -29,16 +35,29 @@ func New(version string) SD {
 			Use:     "sd",
 			Version: version,
 		},
+		version: version,
 	}
 	s.init()
 	return s
 }
 
 func (s *sd) init() {
+	s.root.SetUsageTemplate(usageTemplate)
+	s.root.SetFlagErrorFunc(usageFlags)
 	s.initAliasing()
 	s.initCompletions()
 	s.initDebugging()
 	s.initEditing()
+	s.initCaching()
+	s.initRooting()
+	s.initRunner()
+	s.initPrompting()
+	s.initNew()
+	s.initDoctor()
+	s.initWhich()
+	s.initShow()
+	s.initList()
+	s.initPick()
 
 	s.initialized = true
 }
@@ -49,19 +68,21 @@ func showUsage(cmd *cobra.Command, _ []string) error {
 
 func (s *sd) Run() error {
 	if !s.initialized {
-		return fmt.Errorf("init() not called")
+		return withCode(ExitFailure, fmt.Errorf("init() not called"))
 	}
 
 	err := s.loadCommands()
 	if err != nil {
 		logrus.Debugf("Error loading commands: %v", err)
-		return err
+		// cobra only prints the errors that come out of Execute
+		s.root.PrintErrln("Error:", err.Error())
+		return withCode(ExitFailure, err)
 	}
 
 	err = s.root.Execute()
 	if err != nil {
 		logrus.Debugf("Error executing command: %v", err)
-		return err
+		return classify(err)
 	}
 
 	return nil
@@ -89,6 +110,15 @@ func (s *sd) initAliasing() {
 		}
 	}
 
+	if s.root.Use == "sd" && len(os.Args) > 0 {
+		if alias, scope, ok := binaryAlias(os.Args[0], readAliases(aliasesPath())); ok {
+			s.root.Use = alias
+			s.root.Version = fmt.Sprintf("%s (aliased to %s)", s.root.Version, alias)
+			s.scope = scope
+			logrus.Debug("Aliasing: invoked as ", alias, ", scoped to: ", scope)
+		}
+	}
+
 	s.root.RunE = showUsage
 }
 
@@ -103,7 +133,7 @@ func (s *sd) initCompletions() {
 		Use:   "bash",
 		Short: "Generate completions for bash",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return cmd.Root().GenBashCompletion(os.Stdout)
+			return completionScript(cmd.Root(), "bash", os.Stdout)
 		},
 	})
 
@@ -111,11 +141,29 @@ func (s *sd) initCompletions() {
 		Use:   "zsh",
 		Short: "Generate completions for zsh",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return cmd.Root().GenZshCompletion(os.Stdout)
+			return completionScript(cmd.Root(), "zsh", os.Stdout)
 		},
 	})
 
-	logrus.Debug("Completions (bash/zsh) commands added")
+	c.AddCommand(&cobra.Command{
+		Use:   "fish",
+		Short: "Generate completions for fish",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return completionScript(cmd.Root(), "fish", os.Stdout)
+		},
+	})
+
+	c.AddCommand(&cobra.Command{
+		Use:   "powershell",
+		Short: "Generate completions for PowerShell",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return completionScript(cmd.Root(), "powershell", os.Stdout)
+		},
+	})
+
+	c.AddCommand(installCompletionsCommand(), uninstallCompletionsCommand())
+
+	logrus.Debug("Completions (bash/zsh/fish/powershell) commands added")
 	s.root.AddCommand(c)
 }
 
@@ -134,15 +182,85 @@ func (s *sd) initEditing() {
 	s.root.PersistentFlags().BoolP("edit", "e", false, "Edit command")
 }
 
-func (s *sd) loadCommands() error {
-	logrus.Debug("Loading commands started")
+func (s *sd) initCaching() {
+	s.root.PersistentFlags().Bool("no-cache", false, "Don't use or update the cache of parsed scripts")
+
+	// Flags haven't been parsed yet, we need to do it ourselves
+	for _, arg := range os.Args {
+		if arg == "--no-cache" {
+			logrus.Debug("Cache disabled")
+			s.noCache = true
+		}
+	}
+
+	c := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of parsed scripts",
+		RunE:  showUsage,
+	}
 
+	c.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Remove the cache of parsed scripts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logrus.Debug("Clearing cache at: ", cachePath())
+			if err := os.RemoveAll(completionsDir()); err != nil {
+				return err
+			}
+			return clearCache(cachePath())
+		},
+	})
+
+	s.root.AddCommand(c)
+}
+
+func (s *sd) initRooting() {
+	s.root.PersistentFlags().String("root", "", "Command to treat as the root, making the ones under it top-level (also SD_ROOT)")
+
+	root := os.Getenv("SD_ROOT")
+
+	// Flags haven't been parsed yet, we need to do it ourselves
+	for i, arg := range os.Args {
+		if arg == "--root" && len(os.Args) >= i+2 {
+			root = os.Args[i+1]
+		} else if strings.HasPrefix(arg, "--root=") {
+			root = strings.TrimPrefix(arg, "--root=")
+		}
+	}
+
+	// when invoked through an alias that's already scoped, the root is under
+	// the alias's scope rather than replacing it
+	if root != "" {
+		s.scope = append(append([]string{}, s.scope...), scopeOf(root)...)
+		logrus.Debug("Rooted at: ", s.scope)
+	}
+}
+
+/*
+ * scopeOf splits a command given as the root into its path, which can be
+ * written like it's typed ("ops infra") or like the directories ("ops/infra")
+ */
+func scopeOf(root string) []string {
+	return strings.FieldsFunc(root, func(r rune) bool {
+		return r == ' ' || r == '/'
+	})
+}
+
+func (s *sd) initRunner() {
+	s.root.PersistentFlags().String("runner", "", "How to run scripts: exec (replacing sd, the default) or child")
+}
+
+/*
+ * sources returns the directories scripts get loaded from, in order
+ */
+func sources() ([]string, error) {
 	home := filepath.Join(os.Getenv("HOME"), ".sd")
 	logrus.Debug("HOME is set to: ", home)
 
 	wd, err := os.Getwd()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logrus.Debug("Current working dir is set to: ", wd)
 
@@ -153,37 +271,324 @@ func (s *sd) loadCommands() error {
 	paths := filepath.SplitList(sdPath)
 	logrus.Debug("SD_PATH is set to:", sdPath, ", parsed as: ", paths)
 
-	for _, path := range deduplicate(append([]string{home, current}, paths...)) {
-		cmds, err := visitDir(path)
+	kinds := map[string][]string{
+		"project": {current},
+		"path":    paths,
+		"home":    {home},
+	}
+
+	var roots []string
+	for _, kind := range precedence() {
+		roots = append(roots, kinds[kind]...)
+	}
+	return deduplicate(roots), nil
+}
+
+// kinds of sources, in the order they win over each other by default
+var defaultPrecedence = []string{"project", "path", "home"}
+
+/*
+ * precedence returns the kinds of sources in the order they win over each
+ * other, as given in SD_PRECEDENCE, with any left out in their default order
+ */
+func precedence() []string {
+	var order []string
+	for _, kind := range strings.Split(os.Getenv("SD_PRECEDENCE"), ",") {
+		kind = strings.TrimSpace(kind)
+		switch kind {
+		case "":
+		case "project", "path", "home":
+			order = append(order, kind)
+		default:
+			logrus.Debug("Ignoring unknown source in SD_PRECEDENCE: ", kind)
+		}
+	}
+	return deduplicate(append(order, defaultPrecedence...))
+}
+
+func (s *sd) initPrompting() {
+	s.root.PersistentFlags().Bool("prompt", false, "Ask for missing required arguments when run from a terminal")
+}
+
+func (s *sd) loadCommands() error {
+	logrus.Debug("Loading commands started")
+
+	roots, err := sources()
+	if err != nil {
+		return err
+	}
+
+	var c *cache
+	if !s.noCache {
+		c = loadCache(cachePath(), s.version)
+	}
+
+	for _, name := range s.scope {
+		if strings.HasPrefix(name, ".") {
+			return withCode(ExitUsage, fmt.Errorf("invalid root %q", strings.Join(s.scope, " ")))
+		}
+	}
+	if len(s.scope) > 0 && !anyDir(roots, s.scope) {
+		return withCode(ExitUsage, fmt.Errorf("no such root %q", strings.Join(s.scope, " ")))
+	}
+
+	focus := s.commandPath()
+	logrus.Debug("Loading commands along: ", focus)
+
+	// sources without the command being run are skipped, unless none has it
+	focused := len(focus) > 0 && anyContains(c, roots, s.scope, focus[0])
+
+	for _, path := range roots {
+		dir := filepath.Join(append([]string{path}, s.scope...)...)
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			logrus.Debug("Not a directory, skipping: ", dir)
+			continue
+		}
+		if focused && !dirContains(c, dir, focus[0]) {
+			logrus.Debug("No ", focus[0], " found, skipping: ", dir)
+			continue
+		}
+
+		if len(s.scope) > 0 && s.root.Short == "" && s.root.Long == "" {
+			if readme, err := c.readme(filepath.Join(dir, "README")); err == nil {
+				s.root.Short = strings.Split(readme, "\n")[0]
+				s.root.Long = readme
+			}
+		}
+
+		cmds, err := visitDir(c, dir, focus)
 		if err != nil {
 			return err
 		}
 
-		for _, c := range cmds {
-			s.root.AddCommand(c)
+		for _, cmd := range cmds {
+			setRoot(cmd, path)
+		}
+		mergeCommands(s.root, cmds)
+	}
+
+	// built-ins added since scripts were written can hide them without notice
+	if !completing() {
+		for _, cmd := range s.root.Commands() {
+			for _, path := range shadowedBy(cmd) {
+				if cmd.Annotations["Source"] == "" {
+					s.root.PrintErrf("Warning: %s is shadowed by the built-in %q command\n", path, cmd.Name())
+				}
+			}
 		}
 	}
 
+	if err := c.save(len(focus) == 0 && len(s.scope) == 0); err != nil {
+		logrus.Debug("Error saving cache: ", err)
+	}
+
 	logrus.Debug("Loading commands done")
 	return nil
 }
 
-func visitDir(path string) ([]*cobra.Command, error) {
+/*
+ * completing tells whether sd was called by the shell to complete a command
+ */
+func completing() bool {
+	for _, arg := range os.Args[1:] {
+		if strings.HasPrefix(arg, "__complete") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * dirContains tells whether the directory at path has an entry named name
+ */
+func dirContains(c *cache, path string, name string) bool {
+	items, err := c.list(path)
+	return err == nil && contains(items, name)
+}
+
+/*
+ * anyContains tells whether the directory at scope in any of the sources has
+ * an entry named name
+ */
+func anyContains(c *cache, roots []string, scope []string, name string) bool {
+	for _, path := range roots {
+		if dirContains(c, filepath.Join(append([]string{path}, scope...)...), name) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * anyDir tells whether any of the sources has a directory at scope
+ */
+func anyDir(roots []string, scope []string) bool {
+	for _, path := range roots {
+		if info, err := os.Stat(filepath.Join(append([]string{path}, scope...)...)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * setRoot records which source commands came from
+ */
+func setRoot(cmd *cobra.Command, root string) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations["Root"] = root
+	for _, c := range cmd.Commands() {
+		setRoot(c, root)
+	}
+}
+
+/*
+ * mergeCommands adds cmds to parent. Sources are loaded from the highest
+ * precedence down, so anything already there wins: directories with the same
+ * name get their contents merged, and anything else is shadowed.
+ */
+func mergeCommands(parent *cobra.Command, cmds []*cobra.Command) {
+	for _, cmd := range cmds {
+		existing := findChild(parent, cmd.Name())
+		switch {
+		case existing == nil:
+			parent.AddCommand(cmd)
+
+		case isDir(existing) && isDir(cmd):
+			logrus.Debug("Merging ", cmd.Annotations["Source"], " into: ", existing.Annotations["Source"])
+			if existing.Short == "" && existing.Long == "" {
+				existing.Short, existing.Long = cmd.Short, cmd.Long
+			}
+
+			children := cmd.Commands()
+			cmd.RemoveCommand(children...)
+			mergeCommands(existing, children)
+			if existing.HasSubCommands() || existing.Long != "" {
+				existing.RunE = showUsage
+			}
+
+		default:
+			logrus.Debug(cmd.Annotations["Source"], " is shadowed by: ", existing.CommandPath())
+			if existing.Annotations == nil {
+				existing.Annotations = map[string]string{}
+			}
+			shadows := append(shadowedBy(existing), cmd.Annotations["Source"])
+			existing.Annotations["Shadows"] = strings.Join(shadows, "\n")
+		}
+	}
+}
+
+func findChild(parent *cobra.Command, name string) *cobra.Command {
+	for _, c := range parent.Commands() {
+		if c.Name() == name || c.HasAlias(name) {
+			return c
+		}
+	}
+	return nil
+}
+
+func isDir(cmd *cobra.Command) bool {
+	return cmd.Annotations["Dir"] != ""
+}
+
+/*
+ * shadowedBy returns the paths of the scripts and directories cmd won over
+ */
+func shadowedBy(cmd *cobra.Command) []string {
+	if cmd.Annotations["Shadows"] == "" {
+		return nil
+	}
+	return strings.Split(cmd.Annotations["Shadows"], "\n")
+}
+
+// built-in commands taking the path to another command as their arguments
+var pathCommands = map[string]bool{
+	"help":  true,
+	"list":  true,
+	"show":  true,
+	"which": true,
+}
+
+/*
+ * commandPath returns the leading arguments sd was called with, which name
+ * the command being invoked. Only the branch of the tree along it needs to be
+ * loaded, unless it's empty, which means everything gets loaded.
+ */
+func (s *sd) commandPath() []string {
+	var path []string
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		if arg == "--" {
+			break
+		}
+
+		if strings.HasPrefix(arg, "-") {
+			var f *pflag.Flag
+			if strings.HasPrefix(arg, "--") {
+				f = s.root.PersistentFlags().Lookup(strings.TrimPrefix(arg, "--"))
+			} else if len(arg) == 2 {
+				f = s.root.PersistentFlags().ShorthandLookup(arg[1:])
+			}
+			if f != nil && f.Value.Type() != "bool" {
+				i++
+			}
+			continue
+		}
+
+		path = append(path, arg)
+	}
+
+	if len(path) == 0 {
+		return nil
+	}
+
+	if pathCommands[path[0]] {
+		return path[1:]
+	}
+
+	// built-in commands, like completions, need the whole tree
+	for _, c := range s.root.Commands() {
+		if c.Name() == path[0] {
+			return nil
+		}
+	}
+	if strings.HasPrefix(path[0], "__complete") {
+		return nil
+	}
+
+	return path
+}
+
+/*
+ * visitDir creates commands for everything in path. If focus is given, only
+ * the entry named by its first element is visited (and so on, recursively),
+ * unless there's no such entry, in which case everything is.
+ */
+func visitDir(c *cache, path string, focus []string) ([]*cobra.Command, error) {
 	logrus.Debug("Visiting path: ", path)
 	var cmds []*cobra.Command
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	items, err := c.list(path)
+	if os.IsNotExist(err) {
 		logrus.Debug("Path does not exist: ", path)
 		return cmds, nil
 	}
-
-	items, err := ioutil.ReadDir(path)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(focus) > 0 && !contains(items, focus[0]) {
+		logrus.Debug("No ", focus[0], " found, visiting everything in: ", path)
+		focus = nil
+	}
+
 	for _, item := range items {
 		switch {
+		case len(focus) > 0 && item.Name() != focus[0]:
+			continue
+
 		case strings.HasPrefix(item.Name(), "."):
 			logrus.Debug("Ignoring hidden path: ", filepath.Join(path, item.Name()))
 			continue
@@ -191,20 +596,27 @@ func visitDir(path string) ([]*cobra.Command, error) {
 		case item.IsDir():
 			logrus.Debug("Found directory: ", filepath.Join(path, item.Name()))
 			cmd := &cobra.Command{
-				Use: fmt.Sprintf("%s [command]", item.Name()),
+				Use:  fmt.Sprintf("%s [command]", item.Name()),
+				Args: cobra.NoArgs,
+				Annotations: map[string]string{
+					"Source": filepath.Join(path, item.Name()),
+					"Dir":    "true",
+				},
 			}
 
-			readmePath := filepath.Join(path, item.Name(), "README")
-			readme, err := ioutil.ReadFile(readmePath)
+			readme, err := c.readmeIn(filepath.Join(path, item.Name()))
 			if err == nil {
-				logrus.Debug("Found README at: ", readmePath)
-				cmd.Short = strings.Split(string(readme), "\n")[0]
-				cmd.Long = string(readme)
-				cmd.Args = cobra.NoArgs
+				logrus.Debug("Found README in: ", filepath.Join(path, item.Name()))
+				cmd.Short = strings.Split(readme, "\n")[0]
+				cmd.Long = readme
 				cmd.RunE = showUsage
 			}
 
-			subcmds, err := visitDir(filepath.Join(path, item.Name()))
+			var next []string
+			if len(focus) > 0 {
+				next = focus[1:]
+			}
+			subcmds, err := visitDir(c, filepath.Join(path, item.Name()), next)
 			if err != nil {
 				return nil, err
 			}
@@ -221,52 +633,121 @@ func visitDir(path string) ([]*cobra.Command, error) {
 		case item.Mode()&0100 != 0:
 			logrus.Debug("Script found: ", filepath.Join(path, item.Name()))
 
-			cmd, err := commandFromScript(filepath.Join(path, item.Name()))
+			meta, err := c.meta(filepath.Join(path, item.Name()), item)
 			if err != nil {
-				return nil, err
+				logrus.Debug("Ignoring unreadable script: ", err)
+				continue
 			}
 
-			cmds = append(cmds, cmd)
+			cmds = append(cmds, commandFromMeta(meta))
 		}
 	}
 	return cmds, nil
 }
 
 func commandFromScript(path string) (*cobra.Command, error) {
-	shortDesc, err := shortDescriptionFrom(path)
+	meta, err := parseHeader(path)
 	if err != nil {
 		return nil, err
 	}
+	return commandFromMeta(meta), nil
+}
 
-	usage, args, err := usageFrom(path)
-	if err != nil {
-		return nil, err
-	}
+func commandFromMeta(meta *ScriptMeta) *cobra.Command {
+	usage, args := parseUsage(meta.Name, meta.Usage)
 
 	cmd := &cobra.Command{
 		Use:   usage,
-		Short: shortDesc,
+		Short: meta.Short,
 		Annotations: map[string]string{
-			"Source": path,
+			"Source": meta.Path,
 		},
-		Args: args,
-		RunE: execCommand,
+		Args:              usageArgs(checkedArgs(promptable(args))),
+		ValidArgsFunction: completeArgs,
+		RunE:              execCommand,
 	}
 
-	example, err := exampleFrom(path)
-	if err != nil {
-		return nil, err
+	if meta.Long != "" {
+		cmd.Long = strings.TrimSpace(meta.Short + "\n\n" + meta.Long)
 	}
-	cmd.Example = example
 
-	logrus.Debug("Created command: ", filepath.Base(path))
-	return cmd, nil
+	cmd.Example = formatExamples(meta.Examples)
+
+	if meta.Runner != "" {
+		cmd.Annotations["Runner"] = meta.Runner
+	}
+
+	if meta.Prompt {
+		cmd.Annotations["Prompt"] = "true"
+	}
+
+	if meta.Complete != "" {
+		cmd.Annotations["Complete"] = meta.Complete
+		cmd.Annotations["CompleteTTL"] = meta.CompleteTTL
+	}
+
+	for _, f := range meta.Flags {
+		addFlag(cmd, f)
+	}
+
+	if len(meta.Env) > 0 {
+		var lines []string
+		for _, v := range meta.Env {
+			lines = append(lines, v.String())
+		}
+		cmd.Annotations["Env"] = strings.Join(lines, "\n")
+	}
+
+	logrus.Debug("Created command: ", meta.Name)
+	return cmd
+}
+
+/*
+ * formatExamples renders examples for the help text, captions as comments
+ * above the commands they describe
+ */
+func formatExamples(examples []scriptExample) string {
+	var entries []string
+	sep := "\n"
+	for _, e := range examples {
+		entry := fmt.Sprintf("  %s", e.Command)
+		if e.Caption != "" {
+			entry = fmt.Sprintf("  # %s\n%s", e.Caption, entry)
+			sep = "\n\n"
+		}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, sep)
+}
+
+// flagEnvAnnotation marks flags declared by scripts, holding the name of the
+// environment variable their value gets exported as
+const flagEnvAnnotation = "sd_env"
+
+func addFlag(cmd *cobra.Command, f scriptFlag) {
+	switch f.Type {
+	case "bool":
+		v, _ := strconv.ParseBool(f.Default)
+		cmd.Flags().BoolP(f.Name, f.Shorthand, v, f.Description)
+	case "int":
+		v, _ := strconv.Atoi(f.Default)
+		cmd.Flags().IntP(f.Name, f.Shorthand, v, f.Description)
+	default:
+		cmd.Flags().StringP(f.Name, f.Shorthand, f.Default, f.Description)
+	}
+
+	err := cmd.Flags().SetAnnotation(f.Name, flagEnvAnnotation, []string{f.envName()})
+	if err != nil {
+		panic(err)
+	}
+	logrus.Debug("Added flag --", f.Name, " to command: ", cmd.Name())
 }
 
 // these get mocked in tests
 var (
 	syscallExec = syscall.Exec
 	env         = os.Getenv
+	lookPath    = exec.LookPath
 )
 
 func execCommand(cmd *cobra.Command, args []string) error {
@@ -277,31 +758,109 @@ func execCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	if edit {
-		editor := env("VISUAL")
-		if editor == "" {
-			logrus.Debug("$VISUAL not set, trying $EDITOR...")
-			editor = env("EDITOR")
-			if editor == "" {
-				logrus.Debug("$EDITOR not set, trying $(which vim)...")
-				editor = "$(command -v vim)"
-			}
+		return editFile(src)
+	}
+
+	if missing := missingArgs(cmd, args); len(missing) > 0 && shouldPrompt(cmd) {
+		values, err := promptArgs(bufio.NewReader(stdin), cmd.ErrOrStderr(), missing)
+		if err != nil {
+			return withCode(ExitUsage, err)
+		}
+		args = append(args, values...)
+	}
+	if defaults := defaultArgs(cmd.Use, args); len(defaults) > 0 {
+		logrus.Debug("Filling in defaults for arguments not given: ", defaults)
+		args = append(args, defaults...)
+	}
+
+	dotenv := dotenvFor(cmd)
+
+	var missing []string
+	for _, v := range envVarsOf(cmd) {
+		if v.Required && env(v.Name) == "" && dotenv[v.Name] == "" {
+			missing = append(missing, v.Name)
 		}
-		cmdline := []string{"sh", "-c", strings.Join([]string{editor, src}, " ")}
-		logrus.Debug("Running ", cmdline)
-		return syscallExec("/bin/sh", cmdline, os.Environ())
+	}
+	if len(missing) > 0 {
+		return withCode(ExitMissingEnv, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", ")))
+	}
+
+	runner, err := runnerFor(cmd)
+	if err != nil {
+		return err
+	}
+
+	// hooks need sd to still be around after the script is done
+	before, after := findHooks(cmd.Annotations["Root"], src)
+	if runner == runnerChild || len(before) > 0 || len(after) > 0 {
+		return runWithHooks(cmd, src, args, makeEnv(cmd, dotenv), before, after)
 	}
 
 	logrus.Debug("Exec: ", src, " with args: ", args)
-	return syscallExec(src, append([]string{src}, args...), makeEnv(cmd))
+	return notFound(src, syscallExec(src, append([]string{src}, args...), makeEnv(cmd, dotenv)))
+}
+
+/*
+ * editFile replaces sd with the user's editor on src. The editor is looked up
+ * first, so that not finding one fails with ExitEditFailed rather than the
+ * shell's own exit code. Once started, its exit code is what sd exits with.
+ */
+func editFile(src string) error {
+	editor := env("VISUAL")
+	if editor == "" {
+		logrus.Debug("$VISUAL not set, trying $EDITOR...")
+		editor = env("EDITOR")
+		if editor == "" {
+			logrus.Debug("$EDITOR not set, trying vim...")
+			editor = "vim"
+		}
+	}
+
+	fields := strings.Fields(editor)
+	if len(fields) == 0 {
+		return withCode(ExitEditFailed, fmt.Errorf("no editor set, set VISUAL or EDITOR"))
+	}
+	if _, err := lookPath(fields[0]); err != nil {
+		return withCode(ExitEditFailed, fmt.Errorf("can't start editor %q: %v", editor, err))
+	}
+
+	cmdline := []string{"sh", "-c", strings.Join([]string{editor, src}, " ")}
+	logrus.Debug("Running ", cmdline)
+	return withCode(ExitEditFailed, syscallExec("/bin/sh", cmdline, os.Environ()))
+}
+
+func notFound(src string, err error) error {
+	if os.IsNotExist(err) || os.IsPermission(err) || err == syscall.ENOEXEC {
+		return withCode(ExitScriptNotFound, fmt.Errorf("can't run %s: %v", src, err))
+	}
+	return err
 }
 
-func makeEnv(cmd *cobra.Command) []string {
+/*
+ * makeEnv returns the environment to run cmd's script in: the one sd was
+ * called with, plus the variables in dotenv that it doesn't set already,
+ * and whatever sd itself tells scripts
+ */
+func makeEnv(cmd *cobra.Command, dotenv map[string]string) []string {
 	out := os.Environ()
+	out = append(out, dotenvEnviron(dotenv)...)
 	out = append(out, fmt.Sprintf("SD_ALIAS=%s", cmd.Root().Use))
 
 	if debug, _ := cmd.Root().PersistentFlags().GetBool("debug"); debug {
 		out = append(out, "DEBUG=true")
 	}
 
-	return out
+	for _, v := range envVarsOf(cmd) {
+		if v.Default != "" && env(v.Name) == "" && dotenv[v.Name] == "" {
+			out = append(out, fmt.Sprintf("%s=%s", v.Name, v.Default))
+		}
+	}
+
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if name, ok := f.Annotations[flagEnvAnnotation]; ok {
+			out = append(out, fmt.Sprintf("%s=%s", name[0], f.Value.String()))
+		}
+	})
+
+	return mergeEnv(out)
 }
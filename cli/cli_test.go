@@ -6,7 +6,9 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 
@@ -93,15 +95,31 @@ func TestInitCompletions(t *testing.T) {
 		assert.Equal(t, "completions", cmd.Use)
 
 		t.Run("subcommands", func(t *testing.T) {
-			assert.Len(t, cmd.Commands(), 2)
+			assert.Len(t, cmd.Commands(), 6)
 		})
 
 		t.Run("bash", func(t *testing.T) {
 			assert.Equal(t, "bash", cmd.Commands()[0].Use)
 		})
 
+		t.Run("fish", func(t *testing.T) {
+			assert.Equal(t, "fish", cmd.Commands()[1].Use)
+		})
+
+		t.Run("install", func(t *testing.T) {
+			assert.Equal(t, "install", cmd.Commands()[2].Name())
+		})
+
+		t.Run("powershell", func(t *testing.T) {
+			assert.Equal(t, "powershell", cmd.Commands()[3].Use)
+		})
+
+		t.Run("uninstall", func(t *testing.T) {
+			assert.Equal(t, "uninstall", cmd.Commands()[4].Name())
+		})
+
 		t.Run("zsh", func(t *testing.T) {
-			assert.Equal(t, "zsh", cmd.Commands()[1].Use)
+			assert.Equal(t, "zsh", cmd.Commands()[5].Use)
 		})
 	})
 }
@@ -157,6 +175,67 @@ func TestCommandFromScript(t *testing.T) {
 		assert.Equal(t, "blah", c.Short)
 		assert.Equal(t, "  one two three", c.Example)
 		assert.Equal(t, f.Name(), c.Annotations["Source"])
+		assert.Equal(t, "", c.Long)
+	})
+
+	t.Run("long description", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "test-command-from-script")
+		assert.NoError(t, err)
+
+		f.WriteString(fmt.Sprintf("#\n# %s: blah\n#\n# Much longer\n# text.\n#\n", filepath.Base(f.Name())))
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+
+		c, err := commandFromScript(f.Name())
+		assert.NoError(t, err)
+		assert.Equal(t, "blah\n\nMuch longer\ntext.", c.Long)
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "test-command-from-script")
+		assert.NoError(t, err)
+
+		f.WriteString("#\n# flag: -v, --verbose  Be chatty\n# flag: --count int=2  How many\n#\n")
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+
+		c, err := commandFromScript(f.Name())
+		assert.NoError(t, err)
+
+		verbose := c.Flags().Lookup("verbose")
+		assert.NotNil(t, verbose)
+		assert.Equal(t, "v", verbose.Shorthand)
+		assert.Equal(t, "Be chatty", verbose.Usage)
+
+		assert.NoError(t, c.ParseFlags([]string{"-v", "--count", "5"}))
+		assert.Error(t, c.ParseFlags([]string{"--count", "many"}))
+	})
+
+	t.Run("flags declared twice", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "test-command-from-script")
+		assert.NoError(t, err)
+
+		f.WriteString("#\n# flag: -v, --verbose  Be chatty\n# flag: -v, --vapid  Be dull\n# flag: --verbose  Again\n#\n")
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+
+		var c *cobra.Command
+		assert.NotPanics(t, func() {
+			c, err = commandFromScript(f.Name())
+		})
+		assert.NoError(t, err)
+
+		verbose := c.Flags().Lookup("verbose")
+		assert.NotNil(t, verbose)
+		assert.Equal(t, "v", verbose.Shorthand)
+		assert.Equal(t, "Be chatty", verbose.Usage)
+		assert.Nil(t, c.Flags().Lookup("vapid"))
 	})
 }
 
@@ -169,8 +248,13 @@ func TestExecCommand(t *testing.T) {
 		defer func() {
 			syscallExec = syscall.Exec
 			env = os.Getenv
+			lookPath = exec.LookPath
 		}()
 
+		lookPath = func(file string) (string, error) {
+			return "/usr/bin/" + file, nil
+		}
+
 		env = func(key string) string {
 			if key == "VISUAL" {
 				return "some-visual-editor"
@@ -207,8 +291,13 @@ func TestExecCommand(t *testing.T) {
 		defer func() {
 			syscallExec = syscall.Exec
 			env = os.Getenv
+			lookPath = exec.LookPath
 		}()
 
+		lookPath = func(file string) (string, error) {
+			return "/usr/bin/" + file, nil
+		}
+
 		env = func(key string) string {
 			if key == "VISUAL" {
 				return ""
@@ -248,8 +337,13 @@ func TestExecCommand(t *testing.T) {
 		defer func() {
 			syscallExec = syscall.Exec
 			env = os.Getenv
+			lookPath = exec.LookPath
 		}()
 
+		lookPath = func(file string) (string, error) {
+			return "/usr/bin/" + file, nil
+		}
+
 		env = func(key string) string {
 			return ""
 		}
@@ -258,7 +352,7 @@ func TestExecCommand(t *testing.T) {
 		syscallExec = func(argv0 string, argv []string, envv []string) error {
 			called = true
 			assert.Equal(t, "/bin/sh", argv0)
-			assert.Equal(t, []string{"sh", "-c", "$(command -v vim) /path/to/foo"}, argv)
+			assert.Equal(t, []string{"sh", "-c", "vim /path/to/foo"}, argv)
 			return nil
 		}
 
@@ -308,6 +402,222 @@ func TestExecCommand(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, called)
 	})
+
+	t.Run("fills in defaults", func(t *testing.T) {
+		sd := &sd{root: &cobra.Command{}}
+		sd.initEditing()
+
+		defer func() {
+			syscallExec = syscall.Exec
+		}()
+
+		var got []string
+		syscallExec = func(argv0 string, argv []string, envv []string) error {
+			got = argv
+			return nil
+		}
+
+		cmd := &cobra.Command{
+			Use: "foo <env> [tag=latest]",
+			Annotations: map[string]string{
+				"Source": "/path/to/foo",
+			},
+		}
+		sd.root.AddCommand(cmd)
+
+		assert.NoError(t, execCommand(cmd, []string{"prod"}))
+		assert.Equal(t, []string{"/path/to/foo", "prod", "latest"}, got)
+
+		assert.NoError(t, execCommand(cmd, []string{"prod", "v1"}))
+		assert.Equal(t, []string{"/path/to/foo", "prod", "v1"}, got)
+	})
+
+	t.Run("missing required environment", func(t *testing.T) {
+		sd := &sd{root: &cobra.Command{}}
+		sd.initEditing()
+
+		defer func() {
+			syscallExec = syscall.Exec
+			env = os.Getenv
+		}()
+
+		env = func(key string) string {
+			if key == "SET" {
+				return "yes"
+			}
+			return ""
+		}
+
+		syscallExec = func(argv0 string, argv []string, envv []string) error {
+			assert.Fail(t, "should not exec")
+			return nil
+		}
+
+		cmd := &cobra.Command{
+			Use: "foo",
+			Annotations: map[string]string{
+				"Source": "/path/to/foo",
+				"Env":    "SET (required)\nUNSET (required)\nOTHER (required)\nOPTIONAL",
+			},
+		}
+		sd.root.AddCommand(cmd)
+
+		err := execCommand(cmd, []string{})
+		assert.EqualError(t, err, "missing required environment variables: UNSET, OTHER")
+		assert.Equal(t, ExitMissingEnv, ExitCode(err))
+	})
+
+	t.Run("child runner", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "test-exec-command")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		sd := &sd{root: &cobra.Command{}}
+		sd.initEditing()
+		sd.initRunner()
+		sd.root.PersistentFlags().Set("runner", "child")
+
+		cmd := &cobra.Command{
+			Use: "foo",
+			Annotations: map[string]string{
+				"Source": writeScript(t, dir, "foo", "#!/bin/sh\nexit $1\n"),
+			},
+		}
+		sd.root.AddCommand(cmd)
+
+		assert.NoError(t, execCommand(cmd, []string{"0"}))
+
+		err = execCommand(cmd, []string{"42"})
+		assert.Equal(t, 42, ExitCode(err))
+		assert.True(t, cmd.SilenceErrors)
+		assert.True(t, cmd.SilenceUsage)
+
+		cmd.Annotations["Source"] = filepath.Join(dir, "nope")
+		err = execCommand(cmd, []string{})
+		assert.Equal(t, ExitScriptNotFound, ExitCode(err))
+	})
+
+	t.Run("required environment from .sdenv", func(t *testing.T) {
+		root, err := ioutil.TempDir("", "test-exec-command")
+		assert.NoError(t, err)
+		defer os.RemoveAll(root)
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(root, ".sdenv"), []byte("SD_TEST_REQUIRED=yes\n"), 0644))
+
+		sd := &sd{root: &cobra.Command{}}
+		sd.initEditing()
+
+		defer func() {
+			syscallExec = syscall.Exec
+		}()
+
+		called := false
+		syscallExec = func(argv0 string, argv []string, envv []string) error {
+			called = true
+			assert.Contains(t, envv, "SD_TEST_REQUIRED=yes")
+			return nil
+		}
+
+		cmd := &cobra.Command{
+			Use: "foo",
+			Annotations: map[string]string{
+				"Root":   root,
+				"Source": filepath.Join(root, "foo"),
+				"Env":    "SD_TEST_REQUIRED (required)",
+			},
+		}
+		sd.root.AddCommand(cmd)
+
+		assert.NoError(t, execCommand(cmd, []string{}))
+		assert.True(t, called)
+	})
+
+	t.Run("script not found", func(t *testing.T) {
+		sd := &sd{root: &cobra.Command{}}
+		sd.initEditing()
+
+		defer func() {
+			syscallExec = syscall.Exec
+		}()
+
+		syscallExec = func(argv0 string, argv []string, envv []string) error {
+			return syscall.ENOENT
+		}
+
+		cmd := &cobra.Command{
+			Use: "foo",
+			Annotations: map[string]string{
+				"Source": "/path/to/foo",
+			},
+		}
+		sd.root.AddCommand(cmd)
+
+		err := execCommand(cmd, []string{})
+		assert.Equal(t, ExitScriptNotFound, ExitCode(err))
+	})
+
+	t.Run("edit failed", func(t *testing.T) {
+		sd := &sd{root: &cobra.Command{}}
+		sd.initEditing()
+		sd.root.PersistentFlags().Set("edit", "true")
+
+		defer func() {
+			syscallExec = syscall.Exec
+		}()
+
+		syscallExec = func(argv0 string, argv []string, envv []string) error {
+			return syscall.ENOENT
+		}
+
+		cmd := &cobra.Command{
+			Use: "foo",
+			Annotations: map[string]string{
+				"Source": "/path/to/foo",
+			},
+		}
+		sd.root.AddCommand(cmd)
+
+		err := execCommand(cmd, []string{})
+		assert.Equal(t, ExitEditFailed, ExitCode(err))
+	})
+}
+
+func TestEditFile(t *testing.T) {
+	defer func() {
+		syscallExec = syscall.Exec
+		env = os.Getenv
+	}()
+
+	var tests = []struct {
+		name     string
+		visual   string
+		expected []string
+		code     int
+	}{
+		{"runs the editor", "sh -e", []string{"sh", "-c", "sh -e /path/to/foo"}, 0},
+		{"editor not found", "/does/not/exist --wait", nil, ExitEditFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env = func(key string) string {
+				if key == "VISUAL" {
+					return test.visual
+				}
+				return ""
+			}
+
+			var argv []string
+			syscallExec = func(argv0 string, a []string, envv []string) error {
+				argv = a
+				return nil
+			}
+
+			err := editFile("/path/to/foo")
+			assert.Equal(t, test.code, ExitCode(err))
+			assert.Equal(t, test.expected, argv)
+		})
+	}
 }
 
 func TestInit(t *testing.T) {
@@ -332,6 +642,45 @@ func TestRun(t *testing.T) {
 		err := s.Run()
 		assert.Error(t, err)
 	})
+
+	t.Run("exit codes", func(t *testing.T) {
+		home, err := ioutil.TempDir("", "test-run")
+		assert.NoError(t, err)
+		defer os.RemoveAll(home)
+
+		assert.NoError(t, os.MkdirAll(filepath.Join(home, ".sd", "foo"), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(home, ".sd", "foo", "bar"), []byte("# usage: bar baz\n"), 0755))
+
+		restoreHome := os.Getenv("HOME")
+		restoreArgs := os.Args
+		defer func() {
+			os.Setenv("HOME", restoreHome)
+			os.Args = restoreArgs
+		}()
+		os.Setenv("HOME", home)
+
+		var tests = []struct {
+			name     string
+			args     []string
+			expected int
+		}{
+			{"unknown command", []string{"sd", "--no-cache", "nope"}, ExitUnknownCommand},
+			{"unknown subcommand", []string{"sd", "--no-cache", "foo", "nope"}, ExitUnknownCommand},
+			{"bad arguments", []string{"sd", "--no-cache", "foo", "bar"}, ExitUsage},
+			{"bad flags", []string{"sd", "--no-cache", "foo", "bar", "--nope", "baz"}, ExitUsage},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				os.Args = test.args
+				s := New("1.0").(*sd)
+				s.root.SetOut(ioutil.Discard)
+				s.root.SetErr(ioutil.Discard)
+
+				assert.Equal(t, test.expected, ExitCode(s.Run()))
+			})
+		}
+	})
 }
 
 func TestShowUsage(t *testing.T) {
@@ -413,11 +762,52 @@ func TestRunCompletionsZsh(t *testing.T) {
 	assert.Contains(t, out, "#compdef sd")
 }
 
+func TestRunCompletionsFishAndPowerShell(t *testing.T) {
+	var tests = []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"sd", "completions", "fish"}, []string{"complete -c sd ", "__sd_perform_completion"}},
+		{[]string{"sd", "--alias", "ops", "completions", "fish"}, []string{"complete -c ops ", "__ops_perform_completion"}},
+		{[]string{"sd", "completions", "powershell"}, []string{"Register-ArgumentCompleter -CommandName 'sd'", " __complete "}},
+		{[]string{"sd", "-a", "ops", "completions", "powershell"}, []string{"Register-ArgumentCompleter -CommandName 'ops'"}},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			restore, args := os.Stdout, os.Args
+			defer func() {
+				os.Stdout, os.Args = restore, args
+			}()
+
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			outC := make(chan string)
+			go func() {
+				var buf bytes.Buffer
+				io.Copy(&buf, r)
+				outC <- buf.String()
+			}()
+
+			os.Args = test.args
+			err := New("1.0").Run()
+
+			w.Close()
+			out := <-outC
+
+			assert.NoError(t, err)
+			for _, e := range test.expected {
+				assert.Contains(t, out, e)
+			}
+		})
+	}
+}
+
 func TestMakeEnv(t *testing.T) {
 	t.Run("sets SD_ALIAS", func(t *testing.T) {
 		t.Run("when not aliased", func(t *testing.T) {
 			sd := New("1.0").(*sd)
-			env := makeEnv(sd.root)
+			env := makeEnv(sd.root, nil)
 			assert.Equal(t, "SD_ALIAS=sd", env[len(env)-1])
 		})
 
@@ -431,7 +821,7 @@ func TestMakeEnv(t *testing.T) {
 			os.Args = []string{"-a", "foo"}
 
 			sd := New("1.0").(*sd)
-			env := makeEnv(sd.root)
+			env := makeEnv(sd.root, nil)
 			assert.Equal(t, "SD_ALIAS=foo", env[len(env)-1])
 		})
 	})
@@ -443,7 +833,437 @@ func TestMakeEnv(t *testing.T) {
 		child := &cobra.Command{}
 		root.AddCommand(child)
 
-		env := makeEnv(child)
+		env := makeEnv(child, nil)
 		assert.Equal(t, "DEBUG=true", env[len(env)-1])
 	})
+
+	t.Run("sets defaults for unset variables", func(t *testing.T) {
+		defer func() {
+			env = os.Getenv
+		}()
+
+		env = func(key string) string {
+			if key == "SET" {
+				return "already"
+			}
+			return ""
+		}
+
+		root := &cobra.Command{}
+		child := &cobra.Command{
+			Annotations: map[string]string{
+				"Env": "SET=default\nUNSET=default",
+			},
+		}
+		root.AddCommand(child)
+
+		out := makeEnv(child, nil)
+		assert.Contains(t, out, "UNSET=default")
+		assert.NotContains(t, out, "SET=default")
+	})
+
+	t.Run("merges .sdenv files", func(t *testing.T) {
+		root, err := ioutil.TempDir("", "test-make-env")
+		assert.NoError(t, err)
+		defer os.RemoveAll(root)
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(root, ".sdenv"), []byte("SD_TEST_DOTENV=from-dotenv\nHOME=/overridden\n"), 0644))
+
+		parent := &cobra.Command{}
+		child := &cobra.Command{
+			Annotations: map[string]string{
+				"Root":   root,
+				"Source": filepath.Join(root, "foo"),
+				"Env":    "SD_TEST_DOTENV=default",
+			},
+		}
+		parent.AddCommand(child)
+
+		out := makeEnv(child, dotenvFor(child))
+		assert.Contains(t, out, "SD_TEST_DOTENV=from-dotenv")
+		assert.NotContains(t, out, "SD_TEST_DOTENV=default")
+
+		// the environment sd was called with wins
+		assert.Contains(t, out, "HOME="+os.Getenv("HOME"))
+		assert.NotContains(t, out, "HOME=/overridden")
+	})
+
+	t.Run("sets SD_FLAG_*", func(t *testing.T) {
+		root := &cobra.Command{}
+		child := &cobra.Command{}
+		root.AddCommand(child)
+		addFlag(child, scriptFlag{Name: "dry-run", Type: "bool", Default: "false"})
+		addFlag(child, scriptFlag{Name: "env", Type: "string", Default: "staging"})
+		child.Flags().Set("dry-run", "true")
+
+		env := makeEnv(child, nil)
+		assert.Contains(t, env, "SD_FLAG_DRY_RUN=true")
+		assert.Contains(t, env, "SD_FLAG_ENV=staging")
+	})
+}
+
+func BenchmarkVisitDir(b *testing.B) {
+	dir, err := ioutil.TempDir("", "bench-visit-dir")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 25 directories with 20 scripts each
+	for i := 0; i < 25; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("dir%d", i))
+		if err := os.Mkdir(sub, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 20; j++ {
+			name := fmt.Sprintf("script%d", j)
+			body := fmt.Sprintf("#!/bin/sh\n# %s: blah\n# usage: %s foo\n#\n", name, name)
+			for k := 0; k < 200; k++ {
+				body += "echo \"some script body\"\n"
+			}
+			if err := ioutil.WriteFile(filepath.Join(sub, name), []byte(body), 0755); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := visitDir(nil, dir, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		path := filepath.Join(dir, ".cache.json")
+		c := loadCache(path, "1.0")
+		if _, err := visitDir(c, dir, nil); err != nil {
+			b.Fatal(err)
+		}
+		if err := c.save(true); err != nil {
+			b.Fatal(err)
+		}
+
+		// each run loads the cache from disk, like every call to sd does
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := visitDir(loadCache(path, "1.0"), dir, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestCommandPath(t *testing.T) {
+	var tests = []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{"no args", []string{"sd"}, nil},
+		{"root help", []string{"sd", "--help"}, nil},
+		{"command", []string{"sd", "deploy", "prod", "web"}, []string{"deploy", "prod", "web"}},
+		{"skips flags", []string{"sd", "-d", "deploy", "--edit", "prod"}, []string{"deploy", "prod"}},
+		{"skips flag values", []string{"sd", "-a", "ops", "deploy", "--alias", "x", "prod"}, []string{"deploy", "prod"}},
+		{"skips the root", []string{"sd", "--root", "k8s", "logs", "app"}, []string{"logs", "app"}},
+		{"stops at --", []string{"sd", "deploy", "--", "prod"}, []string{"deploy"}},
+		{"help command", []string{"sd", "help", "deploy", "prod"}, []string{"deploy", "prod"}},
+		{"which command", []string{"sd", "which", "deploy", "prod"}, []string{"deploy", "prod"}},
+		{"built-in command", []string{"sd", "completions", "bash"}, nil},
+		{"completion", []string{"sd", "__complete", "deploy", ""}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			restore := os.Args
+			defer func() {
+				os.Args = restore
+			}()
+			os.Args = test.args
+
+			sd := &sd{root: &cobra.Command{}}
+			sd.initAliasing()
+			sd.initCompletions()
+			sd.initDebugging()
+			sd.initEditing()
+			sd.initRooting()
+
+			assert.Equal(t, test.expected, sd.commandPath())
+		})
+	}
+}
+
+func TestVisitDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-visit-dir")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{"deploy/prod", "deploy/staging", "other"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, d), 0755))
+	}
+	for _, s := range []string{"deploy/prod/web", "deploy/prod/db", "deploy/staging/web", "other/thing", "top"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, s), []byte("#!/bin/sh\n"), 0755))
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "not-a-script"), []byte(""), 0644))
+
+	names := func(cmds []*cobra.Command) []string {
+		var out []string
+		for _, c := range cmds {
+			out = append(out, c.Name())
+		}
+		return out
+	}
+
+	t.Run("visits everything without a focus", func(t *testing.T) {
+		cmds, err := visitDir(nil, dir, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"deploy", "other", "top"}, names(cmds))
+		assert.Equal(t, []string{"prod", "staging"}, names(cmds[0].Commands()))
+	})
+
+	t.Run("only visits the focused branch", func(t *testing.T) {
+		cmds, err := visitDir(nil, dir, []string{"deploy", "prod", "web"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"deploy"}, names(cmds))
+		assert.Equal(t, []string{"prod"}, names(cmds[0].Commands()))
+		assert.Equal(t, []string{"web"}, names(cmds[0].Commands()[0].Commands()))
+	})
+
+	t.Run("visits everything under the end of the focus", func(t *testing.T) {
+		cmds, err := visitDir(nil, dir, []string{"deploy"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"deploy"}, names(cmds))
+		assert.Equal(t, []string{"prod", "staging"}, names(cmds[0].Commands()))
+	})
+
+	t.Run("visits everything at the level where the focus is unknown", func(t *testing.T) {
+		cmds, err := visitDir(nil, dir, []string{"deploy", "typo"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"deploy"}, names(cmds))
+		assert.Equal(t, []string{"prod", "staging"}, names(cmds[0].Commands()))
+	})
+}
+
+func TestFormatExamples(t *testing.T) {
+	t.Run("none", func(t *testing.T) {
+		assert.Equal(t, "", formatExamples(nil))
+	})
+
+	t.Run("without captions", func(t *testing.T) {
+		assert.Equal(t, "  foo 1\n  foo 2", formatExamples([]scriptExample{
+			{Command: "foo 1"},
+			{Command: "foo 2"},
+		}))
+	})
+
+	t.Run("with captions", func(t *testing.T) {
+		assert.Equal(t, "  # Does one\n  foo 1\n\n  foo 2", formatExamples([]scriptExample{
+			{Command: "foo 1", Caption: "Does one"},
+			{Command: "foo 2"},
+		}))
+	})
+}
+
+func TestInitRooting(t *testing.T) {
+	restore, args := os.Getenv("SD_ROOT"), os.Args
+	defer func() {
+		os.Setenv("SD_ROOT", restore)
+		os.Args = args
+	}()
+
+	var tests = []struct {
+		name     string
+		env      string
+		args     []string
+		expected []string
+	}{
+		{"not rooted", "", []string{"sd", "logs"}, nil},
+		{"from SD_ROOT", "k8s", []string{"sd", "logs"}, []string{"k8s"}},
+		{"from the flag", "", []string{"sd", "--root", "k8s", "logs"}, []string{"k8s"}},
+		{"from the flag with =", "", []string{"sd", "--root=ops/infra", "logs"}, []string{"ops", "infra"}},
+		{"flag wins", "k8s", []string{"sd", "--root", "ops infra", "logs"}, []string{"ops", "infra"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv("SD_ROOT", test.env)
+			os.Args = test.args
+
+			s := &sd{root: &cobra.Command{Use: "sd"}}
+			s.initRooting()
+			assert.Equal(t, test.expected, s.scope)
+		})
+	}
+
+	t.Run("under an alias's scope", func(t *testing.T) {
+		os.Setenv("SD_ROOT", "")
+		os.Args = []string{"ops", "--root", "infra", "logs"}
+
+		s := &sd{root: &cobra.Command{Use: "ops"}, scope: []string{"ops"}}
+		s.initRooting()
+		assert.Equal(t, []string{"ops", "infra"}, s.scope)
+	})
+}
+
+func TestLoadCommandsBuiltins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-load-commands-builtins")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	restore, restorePath, args := os.Getenv("HOME"), os.Getenv("SD_PATH"), os.Args
+	defer func() {
+		os.Setenv("HOME", restore)
+		os.Setenv("SD_PATH", restorePath)
+		os.Args = args
+	}()
+	os.Setenv("HOME", dir)
+	os.Setenv("SD_PATH", "")
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, ".sd"), 0755))
+	script := writeScript(t, filepath.Join(dir, ".sd"), "list", "#!/bin/sh\n# list: Lists things.\n")
+
+	var tests = []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"warns about shadowed scripts", []string{"sd", "list"}, fmt.Sprintf("Warning: %s is shadowed by the built-in \"list\" command\n", script)},
+		{"but not when completing", []string{"sd", "__complete", "li"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Args = test.args
+
+			s := &sd{root: &cobra.Command{Use: "sd"}, noCache: true}
+			s.root.AddCommand(&cobra.Command{Use: "list"})
+			var out bytes.Buffer
+			s.root.SetErr(&out)
+
+			assert.NoError(t, s.loadCommands())
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
+
+func TestLoadCommandsFocus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-load-commands-focus")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	restore, restorePath, args := os.Getenv("HOME"), os.Getenv("SD_PATH"), os.Args
+	defer func() {
+		os.Setenv("HOME", restore)
+		os.Setenv("SD_PATH", restorePath)
+		os.Args = args
+	}()
+	os.Setenv("HOME", dir)
+	os.Setenv("SD_PATH", filepath.Join(dir, "path"))
+
+	for _, d := range []string{".sd/deploy", ".sd/other", "path/misc"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, d), 0755))
+	}
+	writeScript(t, filepath.Join(dir, ".sd", "deploy"), "web", "#!/bin/sh\n# web: Deploys the web.\n")
+	writeScript(t, filepath.Join(dir, ".sd", "other"), "thing", "#!/bin/sh\n# thing: A thing.\n")
+	writeScript(t, filepath.Join(dir, "path", "misc"), "tool", "#!/bin/sh\n# tool: A tool.\n")
+
+	var tests = []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{"skips sources without the command", []string{"sd", "deploy", "web"}, []string{"deploy"}},
+		{"walks every source when none has it", []string{"sd", "nosuch"}, []string{"deploy", "misc", "other"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Args = test.args
+
+			s := &sd{root: &cobra.Command{Use: "sd"}, noCache: true}
+			assert.NoError(t, s.loadCommands())
+
+			var names []string
+			for _, c := range loaded(s.root) {
+				names = append(names, c.Name())
+			}
+			assert.Equal(t, test.expected, names)
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	var tests = []struct {
+		value    string
+		expected []string
+	}{
+		{"", []string{"project", "path", "home"}},
+		{"home", []string{"home", "project", "path"}},
+		{"path, home,project", []string{"path", "home", "project"}},
+		{"nope,home", []string{"home", "project", "path"}},
+	}
+
+	restore := os.Getenv("SD_PRECEDENCE")
+	defer os.Setenv("SD_PRECEDENCE", restore)
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			os.Setenv("SD_PRECEDENCE", test.value)
+			assert.Equal(t, test.expected, precedence())
+		})
+	}
+}
+
+func TestMergeCommands(t *testing.T) {
+	dir := func(source string, short string, children ...*cobra.Command) *cobra.Command {
+		c := &cobra.Command{
+			Use:         filepath.Base(source) + " [command]",
+			Short:       short,
+			Annotations: map[string]string{"Source": source, "Dir": "true"},
+		}
+		c.AddCommand(children...)
+		return c
+	}
+	script := func(source string) *cobra.Command {
+		return &cobra.Command{Use: filepath.Base(source), Annotations: map[string]string{"Source": source}, RunE: execCommand}
+	}
+
+	root := &cobra.Command{Use: "sd"}
+	root.AddCommand(&cobra.Command{Use: "doctor"})
+
+	mergeCommands(root, []*cobra.Command{
+		dir("/project/deploy", "", script("/project/deploy/web")),
+		script("/project/top"),
+	})
+	mergeCommands(root, []*cobra.Command{
+		dir("/home/deploy", "Deploys things", script("/home/deploy/web"), script("/home/deploy/db")),
+		dir("/home/top", "", script("/home/top/nested")),
+		script("/home/doctor"),
+	})
+
+	deploy, _, err := root.Find([]string{"deploy"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/project/deploy", deploy.Annotations["Source"])
+	assert.Equal(t, "Deploys things", deploy.Short)
+	assert.Len(t, deploy.Commands(), 2)
+
+	web, _, err := root.Find([]string{"deploy", "web"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/project/deploy/web", web.Annotations["Source"])
+	assert.Equal(t, []string{"/home/deploy/web"}, shadowedBy(web))
+
+	db, _, err := root.Find([]string{"deploy", "db"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/home/deploy/db", db.Annotations["Source"])
+	assert.Empty(t, shadowedBy(db))
+
+	top, _, err := root.Find([]string{"top"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/project/top", top.Annotations["Source"])
+	assert.Equal(t, []string{"/home/top"}, shadowedBy(top))
+
+	doctor, _, err := root.Find([]string{"doctor"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/home/doctor"}, shadowedBy(doctor))
 }
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// interpreters that don't use # for comments, and what they use instead
+var commentLeaders = map[string]string{
+	"node": "//", "nodejs": "//", "deno": "//", "bun": "//", "ts-node": "//", "tsx": "//",
+	"dart": "//", "swift": "//", "scala": "//", "kotlin": "//", "groovy": "//", "jshell": "//",
+	"lua": "--", "luajit": "--", "sqlite3": "--", "psql": "--", "runghc": "--", "runhaskell": "--",
+	"sbcl": ";", "clisp": ";", "ecl": ";", "racket": ";", "guile": ";", "csi": ";",
+	"chibi-scheme": ";", "emacs": ";", "newlisp": ";", "bb": ";", "clojure": ";", "hy": ";",
+}
+
+/*
+ * commentStyle turns comments in a script's language into the #-style ones
+ * the header parser understands, so that "// usage: foo", "-- usage: foo",
+ * ";; usage: foo" and " * usage: foo" inside a block all read as "# usage: foo".
+ */
+type commentStyle struct {
+	leader  string
+	blocks  bool
+	inBlock bool
+}
+
+/*
+ * detectCommentStyle works out how comments look in a script, from the
+ * interpreter in its shebang line or, failing that, from its first line
+ */
+func detectCommentStyle(first string) *commentStyle {
+	leader := "#"
+	if strings.HasPrefix(first, "#!") {
+		if l, ok := commentLeaders[interpreter(first)]; ok {
+			leader = l
+		}
+	} else {
+		line := strings.TrimSpace(first)
+		for _, l := range []string{"//", "/*", "--", ";"} {
+			if strings.HasPrefix(line, l) {
+				leader = l
+				break
+			}
+		}
+	}
+
+	if leader == "/*" {
+		leader = "//"
+	}
+	return &commentStyle{leader: leader, blocks: leader == "//"}
+}
+
+/*
+ * interpreter returns the name of the program in a shebang line, looking
+ * past /usr/bin/env and its options
+ */
+func interpreter(shebang string) string {
+	fields := strings.Fields(strings.TrimPrefix(shebang, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	prog := filepath.Base(fields[0])
+	if prog != "env" {
+		return prog
+	}
+	for _, f := range fields[1:] {
+		if strings.HasPrefix(f, "-") || strings.Contains(f, "=") {
+			continue
+		}
+		return filepath.Base(f)
+	}
+	return ""
+}
+
+/*
+ * uncomment returns line as a #-style comment, or false if it's not a comment
+ */
+func (c *commentStyle) uncomment(line string) (string, bool) {
+	if c.inBlock {
+		text := strings.TrimSpace(line)
+		if i := strings.Index(text, "*/"); i >= 0 {
+			c.inBlock = false
+			text = strings.TrimRight(text[:i], " ")
+		}
+		if !strings.HasPrefix(text, "*/") {
+			text = strings.TrimPrefix(text, "*")
+		}
+		return "#" + text, true
+	}
+
+	if c.blocks && strings.HasPrefix(line, "/*") {
+		c.inBlock = true
+		text := strings.TrimLeft(strings.TrimPrefix(line, "/*"), "*")
+		if i := strings.Index(text, "*/"); i >= 0 {
+			c.inBlock = false
+			text = strings.TrimRight(text[:i], " ")
+		}
+		return "#" + text, true
+	}
+
+	if !strings.HasPrefix(line, c.leader) {
+		return "", false
+	}
+
+	text := strings.TrimPrefix(line, c.leader)
+	if c.leader == ";" {
+		text = strings.TrimLeft(text, ";")
+	}
+	return "#" + text, true
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpreter(t *testing.T) {
+	var tests = []struct {
+		shebang  string
+		expected string
+	}{
+		{"#!/bin/sh", "sh"},
+		{"#!/usr/local/bin/node --harmony", "node"},
+		{"#!/usr/bin/env lua", "lua"},
+		{"#!/usr/bin/env -S sbcl --script", "sbcl"},
+		{"#!/usr/bin/env FOO=bar node", "node"},
+		{"#!", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.shebang, func(t *testing.T) {
+			assert.Equal(t, test.expected, interpreter(test.shebang))
+		})
+	}
+}
+
+func TestDetectCommentStyle(t *testing.T) {
+	var tests = []struct {
+		first    string
+		expected string
+	}{
+		{"#!/bin/bash", "#"},
+		{"#!/usr/bin/env python3", "#"},
+		{"#!/usr/bin/env node", "//"},
+		{"#!/usr/bin/lua", "--"},
+		{"#!/usr/bin/env racket", ";"},
+		{"# foo: bar", "#"},
+		{"// foo: bar", "//"},
+		{"/*", "//"},
+		{"-- foo: bar", "--"},
+		{";; foo: bar", ";"},
+		{"something else", "#"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.first, func(t *testing.T) {
+			assert.Equal(t, test.expected, detectCommentStyle(test.first).leader)
+		})
+	}
+}
+
+func TestUncomment(t *testing.T) {
+	type line struct {
+		input    string
+		expected string
+		comment  bool
+	}
+
+	var tests = []struct {
+		name   string
+		leader string
+		lines  []line
+	}{
+		{
+			"hash",
+			"#",
+			[]line{
+				{"# foo: bar", "# foo: bar", true},
+				{"#", "#", true},
+				{"echo", "", false},
+			},
+		},
+		{
+			"double slash",
+			"//",
+			[]line{
+				{"// foo: bar", "# foo: bar", true},
+				{"# foo: bar", "", false},
+				{"console.log()", "", false},
+			},
+		},
+		{
+			"double dash",
+			"--",
+			[]line{
+				{"-- foo: bar", "# foo: bar", true},
+				{"--", "#", true},
+				{"print()", "", false},
+			},
+		},
+		{
+			"semicolons",
+			";",
+			[]line{
+				{"; foo: bar", "# foo: bar", true},
+				{";; foo: bar", "# foo: bar", true},
+				{";;; foo: bar", "# foo: bar", true},
+				{"(print)", "", false},
+			},
+		},
+		{
+			"block",
+			"//",
+			[]line{
+				{"/**", "#", true},
+				{" * foo: bar", "# foo: bar", true},
+				{" *", "#", true},
+				{"   indented text", "#indented text", true},
+				{" */", "#", true},
+				{"// usage: foo", "# usage: foo", true},
+				{"/* example: foo 1 */", "# example: foo 1", true},
+				{"main()", "", false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &commentStyle{leader: test.leader, blocks: test.leader == "//"}
+			for _, l := range test.lines {
+				text, ok := c.uncomment(l.input)
+				assert.Equal(t, l.comment, ok, l.input)
+				assert.Equal(t, l.expected, text, l.input)
+			}
+		})
+	}
+}
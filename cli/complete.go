@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// completeSelf is the "# complete:" hook that runs the script itself
+const completeSelf = "self"
+
+// how long completion hooks get to run, unless SD_COMPLETE_TIMEOUT says otherwise
+const defaultCompleteTimeout = 2 * time.Second
+
+// completions is what gets cached of a completion hook's output
+type completions struct {
+	Time       int64    `json:"time"`
+	Expires    int64    `json:"expires"`
+	Candidates []string `json:"candidates"`
+}
+
+/*
+ * completeFromHook completes the argument being typed with what the script's
+ * "# complete:" hook prints, one candidate per line. The hook is either a
+ * shell command, or "self", meaning the script itself gets run with
+ * SD_COMPLETE=1. Either way, it gets the arguments typed so far, followed by
+ * the one being completed.
+ */
+func completeFromHook(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	hook := cmd.Annotations["Complete"]
+	if hook == "" {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	ttl, _ := time.ParseDuration(cmd.Annotations["CompleteTTL"])
+	noCache, _ := cmd.Root().PersistentFlags().GetBool("no-cache")
+	caching := ttl > 0 && !noCache
+	path := completionsPath(cmd.Annotations["Source"], hook, args)
+
+	candidates, ok := cachedCompletions(path, ttl)
+	if !ok || noCache {
+		// what gets cached is used whatever has been typed of the argument
+		// since, so the hook isn't told what that is
+		typed := toComplete
+		if caching {
+			typed = ""
+		}
+
+		var err error
+		candidates, err = runCompleteHook(cmd, hook, args, typed)
+		if err != nil {
+			logrus.Debug("Error running completion hook: ", err)
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		if caching {
+			pruneCompletions()
+			now := time.Now()
+			data, _ := json.Marshal(completions{Time: now.Unix(), Expires: now.Add(ttl).Unix(), Candidates: candidates})
+			if err := writeFileAtomic(path, data); err != nil {
+				logrus.Debug("Error caching completions: ", err)
+			}
+		}
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, toComplete) {
+			matches = append(matches, c)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
+
+/*
+ * completionsPath is where the output of a hook for the given arguments gets
+ * cached. It's the same whatever has been typed of the argument being
+ * completed, as candidates get filtered by that afterwards.
+ */
+func completionsPath(src string, hook string, args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{src, hook}, args...), "\x00")))
+	return filepath.Join(completionsDir(), hex.EncodeToString(sum[:16])+".json")
+}
+
+func completionsDir() string {
+	return filepath.Join(cacheDir(), "completions")
+}
+
+/*
+ * cachedCompletions returns the candidates cached at path, as long as they're
+ * younger than ttl. Expired or corrupt ones get removed.
+ */
+func cachedCompletions(path string, ttl time.Duration) ([]string, bool) {
+	if ttl <= 0 {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var c completions
+	if err := json.Unmarshal(data, &c); err != nil {
+		logrus.Debug("Removing corrupt cached completions: ", path)
+		_ = os.Remove(path)
+		return nil, false
+	}
+	if time.Since(time.Unix(c.Time, 0)) > ttl {
+		logrus.Debug("Removing expired cached completions: ", path)
+		_ = os.Remove(path)
+		return nil, false
+	}
+	return c.Candidates, true
+}
+
+/*
+ * pruneCompletions removes the cached completions that have expired, since
+ * those for arguments that don't get completed again would never be looked
+ * at, and so never removed, otherwise
+ */
+func pruneCompletions() {
+	files, err := ioutil.ReadDir(completionsDir())
+	if err != nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, f := range files {
+		path := filepath.Join(completionsDir(), f.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var c completions
+		if err := json.Unmarshal(data, &c); err != nil || c.Expires < now {
+			logrus.Debug("Pruning cached completions: ", path)
+			_ = os.Remove(path)
+		}
+	}
+}
+
+/*
+ * runCompleteHook runs the hook, killing it along with anything it started
+ * if it takes too long
+ */
+func runCompleteHook(cmd *cobra.Command, hook string, args []string, toComplete string) ([]string, error) {
+	src := cmd.Annotations["Source"]
+	argv := append(append([]string{}, args...), toComplete)
+
+	var c *exec.Cmd
+	if hook == completeSelf {
+		c = exec.Command(src, argv...)
+	} else {
+		c = exec.Command("/bin/sh", append([]string{"-c", hook, src}, argv...)...)
+	}
+	c.Env = append(makeEnv(cmd, dotenvFor(cmd)), "SD_COMPLETE=1", fmt.Sprintf("SD_COMPLETE_INDEX=%d", len(args)))
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var out bytes.Buffer
+	c.Stdout = &out
+
+	timeout := defaultCompleteTimeout
+	if d, err := time.ParseDuration(env("SD_COMPLETE_TIMEOUT")); err == nil {
+		timeout = d
+	}
+
+	logrus.Debug("Running completion hook: ", c.Args)
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-time.After(timeout):
+		_ = syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+		<-done
+		return nil, fmt.Errorf("completion hook timed out after %s", timeout)
+	}
+
+	var candidates []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			candidates = append(candidates, line)
+		}
+	}
+	return candidates, nil
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+// hookCommand returns a command for a script with the given completion hook
+func hookCommand(src string, hook string, ttl string) *cobra.Command {
+	root := &cobra.Command{Use: "sd"}
+	root.PersistentFlags().Bool("no-cache", false, "")
+	cmd := &cobra.Command{
+		Use:         "deploy <env> [tag]",
+		Annotations: map[string]string{"Source": src, "Complete": hook, "CompleteTTL": ttl},
+	}
+	root.AddCommand(cmd)
+	return cmd
+}
+
+func TestCompleteFromHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-complete")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	restore := os.Getenv("XDG_CACHE_HOME")
+	defer os.Setenv("XDG_CACHE_HOME", restore)
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+
+	src := writeScript(t, dir, "deploy", `#!/bin/sh
+if [ "$SD_COMPLETE" = "1" ]; then
+  echo "index $SD_COMPLETE_INDEX"
+  echo "args $*"
+  exit 0
+fi
+exit 1
+`)
+
+	var tests = []struct {
+		name       string
+		hook       string
+		args       []string
+		toComplete string
+		expected   []string
+	}{
+		{"shell command", "echo staging; echo prod; echo preview", nil, "", []string{"staging", "prod", "preview"}},
+		{"filters by prefix", "echo staging; echo prod; echo preview", nil, "pr", []string{"prod", "preview"}},
+		{"gets the script and args", `echo "$0 $1 $2"`, []string{"prod"}, "", []string{src + " prod"}},
+		{"self", completeSelf, []string{"prod"}, "", []string{"index 1", "args prod"}},
+		{"failing hook", "exit 1", nil, "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candidates, directive := completeFromHook(hookCommand(src, test.hook, ""), test.args, test.toComplete)
+			assert.Equal(t, test.expected, candidates)
+			assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+		})
+	}
+
+	t.Run("times out", func(t *testing.T) {
+		defer func() {
+			env = os.Getenv
+		}()
+		env = func(key string) string {
+			if key == "SD_COMPLETE_TIMEOUT" {
+				return "100ms"
+			}
+			return os.Getenv(key)
+		}
+
+		start := time.Now()
+		candidates, _ := completeFromHook(hookCommand(src, "echo early; sleep 5", ""), nil, "")
+		assert.Empty(t, candidates)
+		assert.True(t, time.Since(start) < 2*time.Second)
+	})
+
+	t.Run("caches for the ttl", func(t *testing.T) {
+		counter := filepath.Join(dir, "counter")
+		hook := "echo x >> " + counter + "; echo staging"
+		runs := func() int {
+			data, _ := ioutil.ReadFile(counter)
+			return strings.Count(string(data), "x")
+		}
+
+		cmd := hookCommand(src, hook, "1h")
+		for i := 0; i < 2; i++ {
+			candidates, _ := completeFromHook(cmd, nil, "")
+			assert.Equal(t, []string{"staging"}, candidates)
+		}
+		assert.Equal(t, 1, runs())
+
+		assert.NoError(t, cmd.Root().PersistentFlags().Set("no-cache", "true"))
+		_, _ = completeFromHook(cmd, nil, "")
+		assert.Equal(t, 2, runs())
+
+		_, _ = completeFromHook(hookCommand(src, hook, ""), nil, "")
+		assert.Equal(t, 3, runs())
+	})
+
+	t.Run("caches whatever is typed", func(t *testing.T) {
+		counter := filepath.Join(dir, "prefixes")
+		hook := `echo "$1,$2" >> ` + counter + "; echo staging; echo prod; echo preview"
+
+		cmd := hookCommand(src, hook, "1h")
+		for _, typed := range []string{"", "p", "pr", "pre"} {
+			_, _ = completeFromHook(cmd, []string{"typed"}, typed)
+		}
+		candidates, _ := completeFromHook(cmd, []string{"typed"}, "pre")
+		assert.Equal(t, []string{"preview"}, candidates)
+
+		data, _ := ioutil.ReadFile(counter)
+		assert.Equal(t, "typed,\n", string(data))
+	})
+
+	t.Run("removes expired completions", func(t *testing.T) {
+		assert.NoError(t, os.MkdirAll(completionsDir(), 0755))
+		old := time.Now().Add(-2 * time.Hour).Unix()
+		expired := filepath.Join(completionsDir(), "expired.json")
+		assert.NoError(t, ioutil.WriteFile(expired, []byte(fmt.Sprintf(`{"time":%d,"expires":%d,"candidates":["x"]}`, old, old+60)), 0644))
+		corrupt := filepath.Join(completionsDir(), "corrupt.json")
+		assert.NoError(t, ioutil.WriteFile(corrupt, []byte("{"), 0644))
+
+		_, ok := cachedCompletions(expired, time.Hour)
+		assert.False(t, ok)
+		_, err = os.Stat(expired)
+		assert.True(t, os.IsNotExist(err))
+
+		assert.NoError(t, ioutil.WriteFile(expired, []byte(fmt.Sprintf(`{"time":%d,"expires":%d,"candidates":["x"]}`, old, old+60)), 0644))
+		candidates, _ := completeFromHook(hookCommand(src, "echo prod", "1h"), []string{"other"}, "")
+		assert.Equal(t, []string{"prod"}, candidates)
+		_, err = os.Stat(expired)
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(corrupt)
+		assert.True(t, os.IsNotExist(err))
+
+		_, ok = cachedCompletions(completionsPath(src, "echo prod", []string{"other"}), time.Hour)
+		assert.True(t, ok)
+	})
+}
+
+func TestParseHeaderComplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-parse-header-complete")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := parseHeader(writeScript(t, dir, "foo", "#!/bin/sh\n# foo: blah\n# complete: self\n# complete-ttl: 5m\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "self", m.Complete)
+	assert.Equal(t, "5m", m.CompleteTTL)
+	assert.Empty(t, m.problems)
+
+	m, err = parseHeader(writeScript(t, dir, "bar", "#!/bin/sh\n# bar: blah\n# complete: ls\n# complete-ttl: soon\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ls", m.Complete)
+	assert.Equal(t, "", m.CompleteTTL)
+	assert.Len(t, m.problems, 1)
+}
@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// How bad a problem found by sd doctor is. Errors make it exit with a
+// non-zero code, warnings don't.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// problem is something sd doctor found wrong with a script or directory
+type problem struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+}
+
+func (s *sd) initDoctor() {
+	c := &cobra.Command{
+		Use:     "doctor",
+		Aliases: []string{"lint"},
+		Short:   "Check scripts and directories for problems",
+		Long: `Check every source for problems that keep scripts from showing up or working
+as expected, like missing headers, malformed usage lines or files that aren't
+executable. Exits with a non-zero code if any errors are found.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			roots, err := sources()
+			if err != nil {
+				return err
+			}
+			problems := append(diagnose(roots), shadowed(cmd.Root())...)
+
+			asJSON, _ := cmd.Flags().GetBool("json")
+			if asJSON {
+				err = writeProblemsJSON(cmd.OutOrStdout(), problems)
+			} else {
+				err = writeProblems(cmd.OutOrStdout(), problems)
+			}
+			if err != nil {
+				return err
+			}
+
+			errors := countProblems(problems, severityError)
+			if errors > 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return withCode(ExitFailure, fmt.Errorf("%d errors found", errors))
+			}
+			return nil
+		},
+	}
+
+	c.Flags().Bool("json", false, "Output problems as JSON")
+
+	s.root.AddCommand(c)
+}
+
+/*
+ * diagnose looks for problems in everything under roots
+ */
+func diagnose(roots []string) []problem {
+	problems := []problem{}
+
+	for _, root := range roots {
+		items, err := ioutil.ReadDir(root)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				problems = append(problems, problem{severityError, "unreadable", root, err.Error()})
+			}
+			continue
+		}
+
+		problems = append(problems, diagnoseDir(root, items)...)
+	}
+	return problems
+}
+
+/*
+ * shadowed reports the scripts and directories that lost to others with the
+ * same name in the loaded tree
+ */
+func shadowed(cmd *cobra.Command) []problem {
+	var problems []problem
+	for _, path := range shadowedBy(cmd) {
+		by := cmd.Annotations["Source"]
+		if by == "" {
+			by = fmt.Sprintf("the built-in %q command", cmd.CommandPath())
+		}
+		problems = append(problems, problem{severityWarning, "shadowed", path, fmt.Sprintf("shadowed by %s", by)})
+	}
+	for _, c := range cmd.Commands() {
+		problems = append(problems, shadowed(c)...)
+	}
+	return problems
+}
+
+func diagnoseDir(dir string, items []os.FileInfo) []problem {
+	var problems []problem
+	for _, item := range items {
+		name := item.Name()
+		path := filepath.Join(dir, name)
+		if strings.HasPrefix(name, ".") || name == "README" {
+			continue
+		}
+
+		info := item
+		if item.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Stat(path)
+			if err != nil {
+				problems = append(problems, problem{severityError, "broken-symlink", path, err.Error()})
+				continue
+			}
+			info = target
+		}
+
+		if info.IsDir() {
+			problems = append(problems, diagnoseSubdir(path)...)
+			continue
+		}
+		problems = append(problems, diagnoseFile(path, info)...)
+	}
+	return problems
+}
+
+func diagnoseSubdir(path string) []problem {
+	items, err := ioutil.ReadDir(path)
+	if err != nil {
+		return []problem{{severityError, "unreadable", path, err.Error()}}
+	}
+
+	var problems []problem
+	visible := 0
+	for _, i := range items {
+		if !strings.HasPrefix(i.Name(), ".") && i.Name() != "README" {
+			visible++
+		}
+	}
+	if visible == 0 {
+		problems = append(problems, problem{severityWarning, "empty-dir", path, "directory has no scripts in it"})
+	}
+	if _, err := os.Stat(filepath.Join(path, "README")); err != nil {
+		problems = append(problems, problem{severityWarning, "no-readme", path, "directory has no README, so it has no description"})
+	}
+	return append(problems, diagnoseDir(path, items)...)
+}
+
+func diagnoseFile(path string, info os.FileInfo) []problem {
+	head, err := readHead(path)
+	if err != nil {
+		return []problem{{severityError, "unreadable", path, err.Error()}}
+	}
+	shebang := bytes.HasPrefix(head, []byte("#!"))
+
+	if info.Mode()&0100 == 0 {
+		if shebang {
+			return []problem{{severityWarning, "not-executable", path, "looks like a script, but isn't executable, so it's ignored"}}
+		}
+		return nil
+	}
+
+	// compiled programs are fine as they are
+	if !shebang && bytes.IndexByte(head, 0) >= 0 {
+		return nil
+	}
+
+	var problems []problem
+	if !shebang {
+		problems = append(problems, problem{severityError, "no-shebang", path, "no #! line, so it can't be run"})
+	}
+
+	meta, err := parseHeader(path)
+	if err != nil {
+		return append(problems, problem{severityError, "unreadable", path, err.Error()})
+	}
+
+	if meta.Short == "" {
+		msg := fmt.Sprintf("no \"# %s: description\" line", meta.Name)
+		if meta.misnamed != "" {
+			msg = fmt.Sprintf("description line is for %q instead of %q", meta.misnamed, meta.Name)
+		}
+		problems = append(problems, problem{severityWarning, "no-description", path, msg})
+	}
+
+	if err := checkUsage(meta.Name, meta.Usage); err != nil {
+		problems = append(problems, problem{severityError, "bad-usage", path, err.Error()})
+	}
+
+	for _, p := range meta.problems {
+		problems = append(problems, problem{severityError, "bad-header", path, p})
+	}
+	return problems
+}
+
+// readHead returns the first few bytes of the file at path
+func readHead(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+/*
+ * checkUsage finds mistakes in usage lines that parseUsage would quietly
+ * turn into something other than what was meant
+ */
+func checkUsage(name string, usage string) error {
+	if usage == "" {
+		return nil
+	}
+
+	parts := usageFields(usage)
+	if parts[0] != name {
+		return fmt.Errorf("usage starts with %q instead of the script's name, %q", parts[0], name)
+	}
+
+	optional := false
+	for i, p := range parts[1:] {
+		switch {
+		case p == "...":
+			if i != len(parts)-2 {
+				return fmt.Errorf("\"...\" can only be at the end of usage: %q", usage)
+			}
+		case strings.HasPrefix(p, "[") != strings.HasSuffix(p, "]"):
+			return fmt.Errorf("unbalanced brackets in %q", p)
+		case strings.Count(p, "<") != strings.Count(p, ">"):
+			return fmt.Errorf("unbalanced angle brackets in %q", p)
+		case len(parseUsageArg(p).Choices) == 1:
+			return fmt.Errorf("unknown type in %q, expected int, float or choices separated by \"|\"", p)
+		case strings.HasPrefix(p, "["):
+			optional = true
+		case optional:
+			return fmt.Errorf("required argument %q comes after optional ones", p)
+		}
+	}
+	return nil
+}
+
+func countProblems(problems []problem, severity string) int {
+	n := 0
+	for _, p := range problems {
+		if p.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func writeProblems(w io.Writer, problems []problem) error {
+	for _, p := range problems {
+		logrus.Debug("Found ", p.Check, " problem in: ", p.Path)
+		if _, err := fmt.Fprintf(w, "%s: %s: %s\n", p.Severity, p.Path, p.Message); err != nil {
+			return err
+		}
+	}
+
+	if len(problems) == 0 {
+		_, err := fmt.Fprintln(w, "No problems found")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d errors, %d warnings\n", countProblems(problems, severityError), countProblems(problems, severityWarning))
+	return err
+}
+
+func writeProblemsJSON(w io.Writer, problems []problem) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(problems)
+}
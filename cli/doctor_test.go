@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckUsage(t *testing.T) {
+	var tests = []struct {
+		usage string
+		ok    bool
+	}{
+		{"", true},
+		{"foo", true},
+		{"foo bar [baz] ...", true},
+		{"foo bar [baz]", true},
+		{"bar baz", false},
+		{"foo  bar", true},
+		{"foo ... bar", false},
+		{"foo [bar", false},
+		{"foo [bar] baz", false},
+		{"foo <n:int> <env:staging|prod> [tag=latest]", true},
+		{"foo <n:integer>", false},
+		{"foo <env:prod", false},
+		{"foo env:prod>", false},
+		{"foo [<tag=latest]", false},
+		{"foo [<tag>=latest]", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.usage, func(t *testing.T) {
+			err := checkUsage("foo", test.usage)
+			if test.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-diagnose")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	home := filepath.Join(dir, "home")
+	for _, d := range []string{"home/ok", "home/empty", "home/undocumented"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, d), 0755))
+	}
+	for _, d := range []string{"home/ok", "home/empty"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, d, "README"), []byte("Docs\n"), 0644))
+	}
+
+	writeScript(t, filepath.Join(home, "ok"), "fine", "#!/bin/sh\n# fine: Is fine.\n# usage: fine [arg]\n")
+	writeScript(t, filepath.Join(home, "undocumented"), "nodesc", "#!/bin/sh\necho hi\n")
+	writeScript(t, filepath.Join(home, "undocumented"), "renamed", "#!/bin/sh\n# renamed.sh: Was renamed.\n")
+	writeScript(t, filepath.Join(home, "undocumented"), "noshebang", "# noshebang: No shebang.\n")
+	writeScript(t, filepath.Join(home, "undocumented"), "badusage", "#!/bin/sh\n# badusage: Bad usage.\n# usage: other\n")
+	writeScript(t, filepath.Join(home, "undocumented"), "badflag", "#!/bin/sh\n# badflag: Bad flag.\n# flag: --help\n")
+	writeScript(t, filepath.Join(home, "undocumented"), "binary", "\x7fELF\x00\x00")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, "ok", "plain"), []byte("#!/bin/sh\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, "ok", "notes.txt"), []byte("notes\n"), 0644))
+	assert.NoError(t, os.Symlink(filepath.Join(dir, "nowhere"), filepath.Join(home, "ok", "broken")))
+
+	problems := diagnose([]string{home, filepath.Join(dir, "missing")})
+
+	type found struct{ severity, check, path string }
+	var got []found
+	for _, p := range problems {
+		rel, err := filepath.Rel(dir, p.Path)
+		assert.NoError(t, err)
+		got = append(got, found{p.Severity, p.Check, rel})
+	}
+
+	assert.Equal(t, []found{
+		{severityWarning, "empty-dir", "home/empty"},
+		{severityError, "broken-symlink", "home/ok/broken"},
+		{severityWarning, "not-executable", "home/ok/plain"},
+		{severityWarning, "no-readme", "home/undocumented"},
+		{severityError, "bad-header", "home/undocumented/badflag"},
+		{severityError, "bad-usage", "home/undocumented/badusage"},
+		{severityWarning, "no-description", "home/undocumented/nodesc"},
+		{severityError, "no-shebang", "home/undocumented/noshebang"},
+		{severityWarning, "no-description", "home/undocumented/renamed"},
+	}, got)
+
+	for _, p := range problems {
+		if p.Check == "no-description" && filepath.Base(p.Path) == "renamed" {
+			assert.Contains(t, p.Message, `"renamed.sh"`)
+		}
+	}
+
+	t.Run("writes JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, writeProblemsJSON(&out, problems))
+
+		var decoded []problem
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+		assert.Equal(t, problems, decoded)
+	})
+
+	t.Run("writes text", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, writeProblems(&out, problems))
+		assert.Contains(t, out.String(), "error: "+filepath.Join(home, "ok", "broken")+": ")
+		assert.Contains(t, out.String(), "4 errors, 5 warnings")
+	})
+
+	t.Run("writes text when all is well", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, writeProblems(&out, []problem{}))
+		assert.Equal(t, "No problems found\n", out.String())
+	})
+}
+
+func TestShadowed(t *testing.T) {
+	root := &cobra.Command{Use: "sd"}
+	builtin := &cobra.Command{Use: "doctor", Annotations: map[string]string{"Shadows": "/home/.sd/doctor"}}
+	dir := &cobra.Command{Use: "deploy", Annotations: map[string]string{"Source": "/project/deploy", "Dir": "true"}}
+	dir.AddCommand(&cobra.Command{Use: "web", Annotations: map[string]string{"Source": "/project/deploy/web", "Shadows": "/home/.sd/deploy/web\n/path/deploy/web"}})
+	root.AddCommand(builtin, dir)
+
+	assert.Equal(t, []problem{
+		{severityWarning, "shadowed", "/home/.sd/deploy/web", "shadowed by /project/deploy/web"},
+		{severityWarning, "shadowed", "/path/deploy/web", "shadowed by /project/deploy/web"},
+		{severityWarning, "shadowed", "/home/.sd/doctor", `shadowed by the built-in "sd doctor" command`},
+	}, shadowed(root))
+}
@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// name of the dotenv-style files merged into the environment of every script
+// in the directory they're in, and in the ones below it
+const dotenvFile = ".sdenv"
+
+var dotenvLine = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_]\w*)\s*=\s*(.*)$`)
+
+/*
+ * dotenvFor returns the variables set by the .sdenv files between the root
+ * of the source cmd came from and its script, innermost winning
+ */
+func dotenvFor(cmd *cobra.Command) map[string]string {
+	vars := map[string]string{}
+	for _, dir := range dirsBetween(cmd.Annotations["Root"], cmd.Annotations["Source"]) {
+		path := filepath.Join(dir, dotenvFile)
+		file, err := os.Open(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logrus.Debug("Error opening ", path, ": ", err)
+			}
+			continue
+		}
+
+		logrus.Debug("Loading environment from: ", path)
+		if err := parseDotenv(file, vars); err != nil {
+			logrus.Debug("Error loading ", path, ": ", err)
+		}
+		if err := file.Close(); err != nil {
+			logrus.Error(err)
+		}
+	}
+	return vars
+}
+
+/*
+ * dotenvEnviron formats variables for the environment, sorted by name
+ */
+func dotenvEnviron(vars map[string]string) []string {
+	var out []string
+	for k, v := range vars {
+		out = append(out, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(out)
+	return out
+}
+
+/*
+ * Parses dotenv-style lines like these into vars:
+ *
+ * # comments, and blank lines, are ignored
+ * AWS_REGION=us-east-1
+ * export AWS_PROFILE=prod          # "export" is optional
+ * GREETING="Hello, ${USER}!\n"     # double quotes expand variables and escapes
+ * PATTERN='$not ${expanded}'       # single quotes don't
+ * CONFIG=$HOME/.config/foo         # unquoted values expand variables too
+ *
+ * Variables already set in the environment sd was called with win, so they're
+ * left out of vars, and get expanded from the environment even after being
+ * set here. Others are expanded from vars first, and then the environment.
+ */
+func parseDotenv(r io.Reader, vars map[string]string) error {
+	lookup := func(name string) string {
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return env(name)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		match := dotenvLine.FindStringSubmatch(line)
+		if match == nil {
+			return fmt.Errorf("line %d: expected NAME=value", n)
+		}
+
+		value, err := dotenvValue(match[2], lookup)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		if _, set := os.LookupEnv(match[1]); set {
+			logrus.Debug("Keeping ", match[1], " from the environment over .sdenv")
+			continue
+		}
+		vars[match[1]] = value
+	}
+	return scanner.Err()
+}
+
+func dotenvValue(raw string, lookup func(string) string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, "'"):
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quote")
+		}
+		return raw[1 : end+1], nil
+
+	case strings.HasPrefix(raw, `"`):
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			switch c := raw[i]; {
+			case c == '"':
+				return b.String(), nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(raw[i])
+				}
+			case c == '$':
+				name, width := varName(raw[i+1:])
+				if width == 0 {
+					b.WriteByte(c)
+					continue
+				}
+				b.WriteString(lookup(name))
+				i += width
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double quote")
+
+	default:
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = raw[:i]
+		}
+		return expand(strings.TrimSpace(raw), lookup), nil
+	}
+}
+
+/*
+ * expand replaces $VAR and ${VAR} in s
+ */
+func expand(s string, lookup func(string) string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+		name, width := varName(s[i+1:])
+		if width == 0 {
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteString(lookup(name))
+		i += width
+	}
+	return b.String()
+}
+
+/*
+ * varName reads the name of a variable at the start of s, either braced or
+ * not, returning how many bytes of s it took up
+ */
+func varName(s string) (string, int) {
+	if strings.HasPrefix(s, "{") {
+		end := strings.Index(s, "}")
+		if end < 0 {
+			return "", 0
+		}
+		return s[1:end], end + 1
+	}
+
+	i := 0
+	for i < len(s) && (s[i] == '_' || s[i] >= 'A' && s[i] <= 'Z' || s[i] >= 'a' && s[i] <= 'z' || i > 0 && s[i] >= '0' && s[i] <= '9') {
+		i++
+	}
+	return s[:i], i
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDotenv(t *testing.T) {
+	defer func() {
+		env = os.Getenv
+	}()
+	env = func(key string) string {
+		if key == "USER" {
+			return "someone"
+		}
+		return ""
+	}
+
+	var tests = []struct {
+		name     string
+		input    string
+		expected map[string]string
+	}{
+		{
+			"simple",
+			"FOO=bar\n",
+			map[string]string{"FOO": "bar"},
+		},
+		{
+			"comments, blank lines and export",
+			"# comment\n\nexport FOO=bar\n  BAR = baz  # trailing\n",
+			map[string]string{"FOO": "bar", "BAR": "baz"},
+		},
+		{
+			"single quotes",
+			"FOO='$USER ${USER} # not a comment'\n",
+			map[string]string{"FOO": "$USER ${USER} # not a comment"},
+		},
+		{
+			"double quotes",
+			`FOO="Hello, ${USER}!\n\t\"quoted\" \$USER $"` + "\n",
+			map[string]string{"FOO": "Hello, someone!\n\t\"quoted\" $USER $"},
+		},
+		{
+			"expands earlier variables",
+			"DIR=/opt\nBIN=$DIR/bin:${USER}\n",
+			map[string]string{"DIR": "/opt", "BIN": "/opt/bin:someone"},
+		},
+		{
+			"unset variables expand to nothing",
+			"FOO=a${NOPE}b\n",
+			map[string]string{"FOO": "ab"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vars := map[string]string{}
+			assert.NoError(t, parseDotenv(strings.NewReader(test.input), vars))
+			assert.Equal(t, test.expected, vars)
+		})
+	}
+
+	t.Run("the environment wins", func(t *testing.T) {
+		restore, set := os.LookupEnv("SD_TEST_PROFILE")
+		defer func() {
+			env = os.Getenv
+			if set {
+				os.Setenv("SD_TEST_PROFILE", restore)
+			} else {
+				os.Unsetenv("SD_TEST_PROFILE")
+			}
+		}()
+		env = os.Getenv
+		os.Setenv("SD_TEST_PROFILE", "dev")
+
+		vars := map[string]string{}
+		assert.NoError(t, parseDotenv(strings.NewReader("SD_TEST_PROFILE=ops\nBUCKET=\"${SD_TEST_PROFILE}-logs\"\n"), vars))
+		assert.Equal(t, map[string]string{"BUCKET": "dev-logs"}, vars)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, input := range []string{"not a variable\n", "FOO='unterminated\n", "FOO=\"unterminated\n"} {
+			assert.Error(t, parseDotenv(strings.NewReader(input), map[string]string{}), input)
+		}
+	})
+}
+
+func TestDotenvFor(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-dotenv-for")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "aws", "ec2"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, dotenvFile), []byte("REGION=us-east-1\nPROFILE=default\nTOP=yes\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "aws", dotenvFile), []byte("REGION=eu-west-1\nZONE=${REGION}a\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "aws", "ec2", dotenvFile), []byte("PROFILE=ec2\n"), 0644))
+
+	cmd := &cobra.Command{
+		Annotations: map[string]string{
+			"Root":   root,
+			"Source": filepath.Join(root, "aws", "ec2", "list"),
+		},
+	}
+
+	vars := dotenvFor(cmd)
+	assert.Equal(t, map[string]string{
+		"REGION":  "eu-west-1",
+		"PROFILE": "ec2",
+		"TOP":     "yes",
+		"ZONE":    "eu-west-1a",
+	}, vars)
+
+	assert.Equal(t, []string{"PROFILE=ec2", "REGION=eu-west-1", "TOP=yes", "ZONE=eu-west-1a"}, dotenvEnviron(vars))
+}
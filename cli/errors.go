@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes for sd's own failures. When sd runs a script without replacing
+// itself with it, the script's exit code is passed through unchanged instead.
+const (
+	// ExitOK means everything went fine
+	ExitOK = 0
+	// ExitFailure is for any failure not covered by the codes below
+	ExitFailure = 1
+	// ExitUsage means the arguments or flags given were invalid
+	ExitUsage = 2
+	// ExitUnknownCommand means there's no such command
+	ExitUnknownCommand = 3
+	// ExitScriptNotFound means the script is gone, or can't be executed
+	ExitScriptNotFound = 4
+	// ExitEditFailed means the editor couldn't be started
+	ExitEditFailed = 5
+	// ExitMissingEnv means required environment variables aren't set
+	ExitMissingEnv = 6
+)
+
+// Error is returned by Run, carrying the code sd should exit with
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the code sd should exit with, given the error Run returned
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ExitFailure
+}
+
+/*
+ * withCode wraps err with an exit code, unless it already carries one
+ */
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Code: code, Err: err}
+}
+
+/*
+ * classify gives errors coming out of cobra the right exit code. Cobra doesn't
+ * type its errors, so unknown commands can only be told apart by the message.
+ */
+func classify(err error) error {
+	if err != nil && strings.HasPrefix(err.Error(), "unknown command") {
+		return withCode(ExitUnknownCommand, err)
+	}
+	return withCode(ExitFailure, err)
+}
+
+/*
+ * usageArgs makes errors from validating arguments usage errors
+ */
+func usageArgs(args cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, a []string) error {
+		return withCode(ExitUsage, args(cmd, a))
+	}
+}
+
+/*
+ * usageFlags makes errors from parsing flags usage errors
+ */
+func usageFlags(_ *cobra.Command, err error) error {
+	return withCode(ExitUsage, err)
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	var tests = []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"no error", nil, ExitOK},
+		{"plain error", errors.New("boom"), ExitFailure},
+		{"with code", &Error{Code: ExitUsage, Err: errors.New("boom")}, ExitUsage},
+		{"wrapped", fmt.Errorf("wrapped: %w", &Error{Code: 42, Err: errors.New("boom")}), 42},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, ExitCode(test.err))
+		})
+	}
+}
+
+func TestWithCode(t *testing.T) {
+	t.Run("nil stays nil", func(t *testing.T) {
+		assert.NoError(t, withCode(ExitUsage, nil))
+	})
+
+	t.Run("adds code", func(t *testing.T) {
+		err := withCode(ExitUsage, errors.New("boom"))
+		assert.EqualError(t, err, "boom")
+		assert.Equal(t, ExitUsage, ExitCode(err))
+	})
+
+	t.Run("keeps existing code", func(t *testing.T) {
+		err := withCode(ExitFailure, withCode(ExitUsage, errors.New("boom")))
+		assert.Equal(t, ExitUsage, ExitCode(err))
+	})
+}
+
+func TestClassify(t *testing.T) {
+	assert.Equal(t, ExitUnknownCommand, ExitCode(classify(errors.New(`unknown command "foo" for "sd"`))))
+	assert.Equal(t, ExitFailure, ExitCode(classify(errors.New("something else"))))
+	assert.Equal(t, ExitUsage, ExitCode(classify(withCode(ExitUsage, errors.New("bad")))))
+	assert.NoError(t, classify(nil))
+}
+
+func TestUsageArgs(t *testing.T) {
+	args := usageArgs(cobra.ExactArgs(1))
+	assert.NoError(t, args(&cobra.Command{}, []string{"one"}))
+	assert.Equal(t, ExitUsage, ExitCode(args(&cobra.Command{}, []string{})))
+}
+
+func TestUsageFlags(t *testing.T) {
+	assert.Equal(t, ExitUsage, ExitCode(usageFlags(&cobra.Command{}, errors.New("bad flag"))))
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cobra.AddTemplateFunc("envUsages", envUsages)
+	cobra.AddTemplateFunc("argUsages", argUsages)
+}
+
+// usageTemplate is cobra's default, plus sections for arguments and
+// environment variables
+const usageTemplate = `Usage:{{if .Runnable}}
+  {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
+  {{.CommandPath}} [command]{{end}}{{if gt (len .Aliases) 0}}
+
+Aliases:
+  {{.NameAndAliases}}{{end}}{{if .HasExample}}
+
+Examples:
+{{.Example}}{{end}}{{if .HasAvailableSubCommands}}{{$cmds := .Commands}}{{if eq (len .Groups) 0}}
+
+Available Commands:{{range $cmds}}{{if (or .IsAvailableCommand (eq .Name "help"))}}
+  {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{else}}{{range $group := .Groups}}
+
+{{.Title}}{{range $cmds}}{{if (and (eq .GroupID $group.ID) (or .IsAvailableCommand (eq .Name "help")))}}
+  {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if not .AllChildCommandsHaveGroup}}
+
+Additional Commands:{{range $cmds}}{{if (and (eq .GroupID "") (or .IsAvailableCommand (eq .Name "help")))}}
+  {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{end}}{{end}}{{if argUsages .}}
+
+Arguments:
+{{argUsages . | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableLocalFlags}}
+
+Flags:
+{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
+
+Global Flags:
+{{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if index .Annotations "Env"}}
+
+Environment:
+{{envUsages . | trimTrailingWhitespaces}}{{end}}{{if .HasHelpSubCommands}}
+
+Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
+  {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
+
+Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
+`
+
+/*
+ * envUsages formats the environment variables documented by a command,
+ * lined up like cobra does with flags
+ */
+func envUsages(cmd *cobra.Command) string {
+	vars := envVarsOf(cmd)
+
+	width := 0
+	for _, v := range vars {
+		if len(v.Name) > width {
+			width = len(v.Name)
+		}
+	}
+
+	var b strings.Builder
+	for _, v := range vars {
+		desc := v.Description
+		if v.Required {
+			desc = strings.TrimSpace(desc + " (required)")
+		}
+		if v.Default != "" {
+			desc = strings.TrimSpace(fmt.Sprintf("%s (default %q)", desc, v.Default))
+		}
+		fmt.Fprintf(&b, "  %-*s   %s\n", width, v.Name, desc)
+	}
+	return b.String()
+}
+
+/*
+ * envVarsOf returns the environment variables documented by a command
+ */
+func envVarsOf(cmd *cobra.Command) []envVar {
+	var vars []envVar
+	for _, line := range strings.Split(cmd.Annotations["Env"], "\n") {
+		if line == "" {
+			continue
+		}
+		v, err := parseEnvVar(line)
+		if err != nil {
+			continue
+		}
+		vars = append(vars, v)
+	}
+	return vars
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvUsages(t *testing.T) {
+	cmd := &cobra.Command{
+		Annotations: map[string]string{
+			"Env": "AWS_PROFILE (required) Profile to use\nAWS_REGION=us-east-1 Region to use",
+		},
+	}
+
+	assert.Equal(t,
+		"  AWS_PROFILE   Profile to use (required)\n"+
+			"  AWS_REGION    Region to use (default \"us-east-1\")\n",
+		envUsages(cmd))
+}
+
+func TestUsageTemplate(t *testing.T) {
+	root := &cobra.Command{Use: "sd"}
+	root.SetUsageTemplate(usageTemplate)
+
+	t.Run("shows environment section", func(t *testing.T) {
+		cmd := &cobra.Command{
+			Use:         "foo",
+			Run:         func(*cobra.Command, []string) {},
+			Annotations: map[string]string{"Env": "FOO (required) Some foo"},
+		}
+		root.AddCommand(cmd)
+
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		assert.NoError(t, cmd.Usage())
+		assert.Contains(t, out.String(), "Environment:\n  FOO   Some foo (required)\n")
+	})
+
+	t.Run("shows arguments section", func(t *testing.T) {
+		cmd := &cobra.Command{
+			Use: "baz <env:staging|prod>",
+			Run: func(*cobra.Command, []string) {},
+		}
+		root.AddCommand(cmd)
+
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		assert.NoError(t, cmd.Usage())
+		assert.Contains(t, out.String(), "Arguments:\n  env   one of: staging, prod\n")
+	})
+
+	t.Run("omits environment section when undocumented", func(t *testing.T) {
+		cmd := &cobra.Command{
+			Use: "bar",
+			Run: func(*cobra.Command, []string) {},
+		}
+		root.AddCommand(cmd)
+
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		assert.NoError(t, cmd.Usage())
+		assert.NotContains(t, out.String(), "Environment:")
+		assert.NotContains(t, out.String(), "Arguments:")
+	})
+}
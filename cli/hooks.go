@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// names of the executables that run before and after every script in the
+// directory they're in, and in the ones below it
+const (
+	beforeHook = ".sd-before"
+	afterHook  = ".sd-after"
+)
+
+/*
+ * findHooks returns the hooks for the script at src, looking in every
+ * directory from root down to the script's. Before hooks are in the order
+ * they run, outermost first; after hooks run the other way around.
+ */
+func findHooks(root string, src string) ([]string, []string) {
+	var before, after []string
+	for _, dir := range dirsBetween(root, src) {
+		if hook := filepath.Join(dir, beforeHook); isExecutable(hook) {
+			logrus.Debug("Found before hook: ", hook)
+			before = append(before, hook)
+		}
+		if hook := filepath.Join(dir, afterHook); isExecutable(hook) {
+			logrus.Debug("Found after hook: ", hook)
+			after = append([]string{hook}, after...)
+		}
+	}
+	return before, after
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0100 != 0
+}
+
+/*
+ * runWithHooks runs the script as a child process, with its before hooks
+ * first and its after hooks once it's done. If a before hook fails, the script
+ * doesn't run at all. After hooks always run, and get the script's exit code
+ * in SD_EXIT_CODE.
+ */
+func runWithHooks(cmd *cobra.Command, src string, args []string, env []string, before []string, after []string) error {
+	hookEnv := append(env,
+		fmt.Sprintf("SD_COMMAND=%s", commandName(cmd)),
+		fmt.Sprintf("SD_ARGS=%s", strings.Join(args, " ")),
+		fmt.Sprintf("SD_SCRIPT=%s", src),
+	)
+
+	// the script has had its say by the time any of these errors come up
+	silence := func(err error) error {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	for _, hook := range before {
+		code, err := runChild(hook, nil, hookEnv)
+		if err != nil {
+			return fmt.Errorf("can't run hook %s: %v", hook, err)
+		}
+		if code != 0 {
+			logrus.Debug("Before hook ", hook, " failed, not running: ", src)
+			return silence(&Error{Code: code, Err: fmt.Errorf("hook %s exited with %d", hook, code)})
+		}
+	}
+
+	code, err := runChild(src, args, env)
+	if err != nil {
+		return notFound(src, err)
+	}
+
+	hookEnv = append(hookEnv, fmt.Sprintf("SD_EXIT_CODE=%d", code))
+	for _, hook := range after {
+		hookCode, err := runChild(hook, nil, hookEnv)
+		if err != nil {
+			logrus.Error("Can't run hook ", hook, ": ", err)
+			continue
+		}
+		if hookCode != 0 && code == 0 {
+			code = hookCode
+		}
+	}
+
+	if code != 0 {
+		return silence(&Error{Code: code, Err: fmt.Errorf("%s exited with %d", src, code)})
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindHooks(t *testing.T) {
+	root, err := ioutil.TempDir("", "test-find-hooks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	writeScript(t, root, beforeHook, "#!/bin/sh\n")
+	writeScript(t, root, afterHook, "#!/bin/sh\n")
+	writeScript(t, filepath.Join(root, "a"), afterHook, "#!/bin/sh\n")
+	writeScript(t, filepath.Join(root, "a", "b"), beforeHook, "#!/bin/sh\n")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "a", beforeHook), []byte("not executable"), 0644))
+
+	t.Run("nested", func(t *testing.T) {
+		before, after := findHooks(root, filepath.Join(root, "a", "b", "script"))
+		assert.Equal(t, []string{
+			filepath.Join(root, beforeHook),
+			filepath.Join(root, "a", "b", beforeHook),
+		}, before)
+		assert.Equal(t, []string{
+			filepath.Join(root, "a", afterHook),
+			filepath.Join(root, afterHook),
+		}, after)
+	})
+
+	t.Run("top level", func(t *testing.T) {
+		before, after := findHooks(root, filepath.Join(root, "script"))
+		assert.Equal(t, []string{filepath.Join(root, beforeHook)}, before)
+		assert.Equal(t, []string{filepath.Join(root, afterHook)}, after)
+	})
+
+	t.Run("no root", func(t *testing.T) {
+		before, after := findHooks("", filepath.Join(root, "script"))
+		assert.Empty(t, before)
+		assert.Empty(t, after)
+	})
+
+	t.Run("outside of root", func(t *testing.T) {
+		before, after := findHooks(filepath.Join(root, "a"), filepath.Join(root, "script"))
+		assert.Empty(t, before)
+		assert.Empty(t, after)
+	})
+}
+
+func TestRunWithHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-run-with-hooks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	log := filepath.Join(dir, "log")
+	logger := func(name string, code string) string {
+		return writeScript(t, dir, name, "#!/bin/sh\necho \""+name+"|$SD_COMMAND|$SD_ARGS|$SD_EXIT_CODE\" >> \""+log+"\"\nexit "+code+"\n")
+	}
+
+	newCmd := func() *cobra.Command {
+		root := &cobra.Command{Use: "sd"}
+		parent := &cobra.Command{Use: "deploy"}
+		cmd := &cobra.Command{Use: "web"}
+		root.AddCommand(parent)
+		parent.AddCommand(cmd)
+		return cmd
+	}
+
+	read := func() string {
+		data, _ := ioutil.ReadFile(log)
+		os.Remove(log)
+		return string(data)
+	}
+
+	t.Run("runs hooks around the script", func(t *testing.T) {
+		err := runWithHooks(newCmd(), logger("script", "0"), []string{"a", "b"}, os.Environ(),
+			[]string{logger("before1", "0"), logger("before2", "0")},
+			[]string{logger("after1", "0")})
+		assert.NoError(t, err)
+		assert.Equal(t, "before1|deploy web|a b|\nbefore2|deploy web|a b|\nscript|||\nafter1|deploy web|a b|0\n", read())
+	})
+
+	t.Run("failing before hook aborts", func(t *testing.T) {
+		cmd := newCmd()
+		err := runWithHooks(cmd, logger("script", "0"), nil, os.Environ(),
+			[]string{logger("before1", "5"), logger("before2", "0")},
+			[]string{logger("after1", "0")})
+		assert.Equal(t, 5, ExitCode(err))
+		assert.True(t, cmd.SilenceUsage)
+		assert.Equal(t, "before1|deploy web||\n", read())
+	})
+
+	t.Run("after hooks get the exit code", func(t *testing.T) {
+		err := runWithHooks(newCmd(), logger("script", "3"), nil, os.Environ(), nil,
+			[]string{logger("after1", "0"), logger("after2", "0")})
+		assert.Equal(t, 3, ExitCode(err))
+		assert.Equal(t, "script|||\nafter1|deploy web||3\nafter2|deploy web||3\n", read())
+	})
+
+	t.Run("failing after hook fails a successful script", func(t *testing.T) {
+		err := runWithHooks(newCmd(), logger("script", "0"), nil, os.Environ(), nil,
+			[]string{logger("after1", "4")})
+		assert.Equal(t, 4, ExitCode(err))
+		read()
+	})
+}
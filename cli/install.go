@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// shells completions can be installed for
+var installableShells = []string{"bash", "zsh", "fish"}
+
+func installCompletionsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "install [bash|zsh|fish]",
+		Short: "Install completions for your shell",
+		Long: `Install completions for the given shell, or the one in $SHELL, where the shell
+looks for them:
+
+  bash  $XDG_DATA_HOME/bash-completion/completions/<name>
+  zsh   ~/.zsh/completions/_<name>, which needs to be in fpath
+  fish  $XDG_CONFIG_HOME/fish/completions/<name>.fish
+
+Completions are for sd, or the alias given with --alias. Installing them again
+updates them.`,
+		Example: `  sd completions install
+  sd --alias ops completions install zsh`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			shell, err := shellFor(args)
+			if err != nil {
+				return err
+			}
+
+			var script bytes.Buffer
+			if err := completionScript(cmd.Root(), shell, &script); err != nil {
+				return err
+			}
+
+			path := completionsFile(shell, cmd.Root().Name())
+			if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, script.Bytes()) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Completions for %s are already installed in %s\n", cmd.Root().Name(), path)
+				return nil
+			}
+
+			logrus.Debug("Writing completions to: ", path)
+			if err := writeFileAtomic(path, script.Bytes()); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Installed completions for %s in %s\n", cmd.Root().Name(), path)
+
+			if shell == "zsh" {
+				fmt.Fprintf(cmd.OutOrStdout(), "Make sure %s is in fpath, by adding this to ~/.zshrc before compinit:\n\n  fpath=(%s $fpath)\n",
+					filepath.Dir(path), filepath.Dir(path))
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Start a new shell to use them.")
+			return nil
+		},
+	}
+}
+
+func uninstallCompletionsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "uninstall [bash|zsh|fish]",
+		Short: "Uninstall completions installed for your shell",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			shell, err := shellFor(args)
+			if err != nil {
+				return err
+			}
+
+			path := completionsFile(shell, cmd.Root().Name())
+			logrus.Debug("Removing completions at: ", path)
+			err = os.Remove(path)
+			if os.IsNotExist(err) {
+				fmt.Fprintf(cmd.OutOrStdout(), "No completions for %s installed in %s\n", cmd.Root().Name(), path)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed completions for %s from %s\n", cmd.Root().Name(), path)
+			return nil
+		},
+	}
+}
+
+/*
+ * shellFor returns the shell given as an argument, or the user's shell going
+ * by $SHELL, as long as completions can be installed for it
+ */
+func shellFor(args []string) (string, error) {
+	shell := filepath.Base(env("SHELL"))
+	if len(args) > 0 {
+		shell = args[0]
+	}
+	if !containsString(installableShells, shell) {
+		if shell == "" || shell == "." {
+			return "", withCode(ExitUsage, fmt.Errorf("couldn't tell which shell to install completions for, expected one of: bash, zsh, fish"))
+		}
+		return "", withCode(ExitUsage, fmt.Errorf("can't install completions for %s, expected one of: bash, zsh, fish", shell))
+	}
+	return shell, nil
+}
+
+// completionScript writes the completions for root in the given shell to w
+func completionScript(root *cobra.Command, shell string, w io.Writer) error {
+	switch shell {
+	case "bash":
+		return root.GenBashCompletion(w)
+	case "zsh":
+		return root.GenZshCompletion(w)
+	case "fish":
+		return root.GenFishCompletion(w, true)
+	case "powershell":
+		return root.GenPowerShellCompletionWithDesc(w)
+	default:
+		return fmt.Errorf("no completions for %s", shell)
+	}
+}
+
+/*
+ * completionsFile is where the shell looks for completions for the command
+ * with the given name
+ */
+func completionsFile(shell string, name string) string {
+	home := os.Getenv("HOME")
+	switch shell {
+	case "bash":
+		dir := os.Getenv("XDG_DATA_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".local", "share")
+		}
+		return filepath.Join(dir, "bash-completion", "completions", name)
+	case "zsh":
+		return filepath.Join(home, ".zsh", "completions", "_"+name)
+	default:
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			dir = filepath.Join(home, ".config")
+		}
+		return filepath.Join(dir, "fish", "completions", name+".fish")
+	}
+}
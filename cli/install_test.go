@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellFor(t *testing.T) {
+	defer func() {
+		env = os.Getenv
+	}()
+
+	var tests = []struct {
+		name     string
+		shell    string
+		args     []string
+		expected string
+		err      bool
+	}{
+		{"from $SHELL", "/usr/local/bin/fish", nil, "fish", false},
+		{"from args", "/bin/bash", []string{"zsh"}, "zsh", false},
+		{"unsupported", "/bin/tcsh", nil, "", true},
+		{"unsupported arg", "/bin/bash", []string{"powershell"}, "", true},
+		{"unknown", "", nil, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env = func(key string) string {
+				if key == "SHELL" {
+					return test.shell
+				}
+				return ""
+			}
+
+			shell, err := shellFor(test.args)
+			assert.Equal(t, test.expected, shell)
+			assert.Equal(t, test.err, err != nil)
+		})
+	}
+}
+
+func TestCompletionsFile(t *testing.T) {
+	restore := map[string]string{}
+	for _, key := range []string{"HOME", "XDG_DATA_HOME", "XDG_CONFIG_HOME"} {
+		restore[key] = os.Getenv(key)
+	}
+	defer func() {
+		for key, value := range restore {
+			os.Setenv(key, value)
+		}
+	}()
+
+	os.Setenv("HOME", "/home/me")
+	os.Setenv("XDG_DATA_HOME", "")
+	os.Setenv("XDG_CONFIG_HOME", "")
+	assert.Equal(t, "/home/me/.local/share/bash-completion/completions/ops", completionsFile("bash", "ops"))
+	assert.Equal(t, "/home/me/.zsh/completions/_ops", completionsFile("zsh", "ops"))
+	assert.Equal(t, "/home/me/.config/fish/completions/ops.fish", completionsFile("fish", "ops"))
+
+	os.Setenv("XDG_DATA_HOME", "/data")
+	os.Setenv("XDG_CONFIG_HOME", "/config")
+	assert.Equal(t, "/data/bash-completion/completions/sd", completionsFile("bash", "sd"))
+	assert.Equal(t, "/config/fish/completions/sd.fish", completionsFile("fish", "sd"))
+}
+
+func TestInstallCompletions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-install-completions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	restore, restoreData := os.Getenv("HOME"), os.Getenv("XDG_DATA_HOME")
+	defer func() {
+		os.Setenv("HOME", restore)
+		os.Setenv("XDG_DATA_HOME", restoreData)
+	}()
+	os.Setenv("HOME", dir)
+	os.Setenv("XDG_DATA_HOME", "")
+
+	run := func(args ...string) string {
+		root := &cobra.Command{Use: "ops"}
+		root.AddCommand(installCompletionsCommand(), uninstallCompletionsCommand())
+
+		var out bytes.Buffer
+		root.SetOut(&out)
+		root.SetArgs(args)
+		assert.NoError(t, root.Execute())
+		return out.String()
+	}
+	path := filepath.Join(dir, ".local", "share", "bash-completion", "completions", "ops")
+
+	out := run("install", "bash")
+	assert.Contains(t, out, "Installed completions for ops in "+path)
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "__ops_debug()")
+
+	out = run("install", "bash")
+	assert.Contains(t, out, "already installed")
+
+	out = run("install", "zsh")
+	assert.Contains(t, out, "fpath=("+filepath.Join(dir, ".zsh", "completions")+" $fpath)")
+	assert.FileExists(t, filepath.Join(dir, ".zsh", "completions", "_ops"))
+
+	out = run("uninstall", "bash")
+	assert.Contains(t, out, "Removed completions for ops from "+path)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	out = run("uninstall", "bash")
+	assert.Contains(t, out, "No completions for ops installed")
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// listEntry is how commands are described in sd list --format json
+type listEntry struct {
+	Command string   `json:"command"`
+	Type    string   `json:"type"`
+	Root    string   `json:"root"`
+	Shadows []string `json:"shadows,omitempty"`
+	*ScriptMeta
+}
+
+func (s *sd) initList() {
+	c := &cobra.Command{
+		Use:   "list [command...]",
+		Short: "List the available commands",
+		Long: `List the commands loaded from every source, or just the ones under the given
+command, in one of these formats:
+
+  tree  names and short descriptions, indented by where they are in the tree
+  flat  the full command of every script, one per line
+  json  everything sd knows about every command and directory`,
+		Example: `  sd list
+  sd list deploy --format flat`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			parent := cmd.Root()
+			if len(args) > 0 {
+				var err error
+				if parent, err = findCommand(cmd.Root(), args); err != nil {
+					return err
+				}
+			}
+
+			format, _ := cmd.Flags().GetString("format")
+			switch format {
+			case "tree":
+				return listTree(cmd.OutOrStdout(), parent)
+			case "flat":
+				return listFlat(cmd.OutOrStdout(), parent)
+			case "json":
+				var c *cache
+				if !s.noCache {
+					c = loadCache(cachePath(), s.version)
+				}
+				return listJSON(cmd.OutOrStdout(), c, parent)
+			default:
+				return withCode(ExitUsage, fmt.Errorf("unknown format %q, expected tree, flat or json", format))
+			}
+		},
+	}
+
+	c.Flags().String("format", "tree", "Output format: tree, flat or json")
+
+	s.root.AddCommand(c)
+}
+
+/*
+ * loaded returns the commands under parent that were loaded from sources,
+ * leaving out the ones built into sd
+ */
+func loaded(parent *cobra.Command) []*cobra.Command {
+	var cmds []*cobra.Command
+	for _, c := range parent.Commands() {
+		if c.Annotations["Source"] != "" {
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds
+}
+
+// commandName is the command to type to run cmd, without sd itself
+func commandName(cmd *cobra.Command) string {
+	return strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+}
+
+func listTree(w io.Writer, parent *cobra.Command) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	var walk func(cmd *cobra.Command, depth int)
+	walk = func(cmd *cobra.Command, depth int) {
+		for _, c := range loaded(cmd) {
+			fmt.Fprintf(tw, "%s%s\t%s\n", strings.Repeat("  ", depth), c.Name(), c.Short)
+			walk(c, depth+1)
+		}
+	}
+	walk(parent, 0)
+
+	return tw.Flush()
+}
+
+func listFlat(w io.Writer, parent *cobra.Command) error {
+	for _, c := range loaded(parent) {
+		if isDir(c) {
+			if err := listFlat(w, c); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintln(w, commandName(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * listJSON writes everything known about the commands under parent. Cobra
+ * only keeps the rendered help text around, so the headers of scripts get
+ * looked up in the cache (or read again) for their details.
+ */
+func listJSON(w io.Writer, c *cache, parent *cobra.Command) error {
+	entries := []listEntry{}
+
+	var walk func(cmd *cobra.Command) error
+	walk = func(cmd *cobra.Command) error {
+		for _, sub := range loaded(cmd) {
+			src := sub.Annotations["Source"]
+			e := listEntry{
+				Command: commandName(sub),
+				Root:    absPath(sub.Annotations["Root"]),
+				Shadows: shadowedBy(sub),
+			}
+
+			if isDir(sub) {
+				e.Type = "directory"
+				e.ScriptMeta = &ScriptMeta{Name: sub.Name(), Short: sub.Short, Long: sub.Long}
+			} else {
+				info, err := os.Lstat(src)
+				if err != nil {
+					return err
+				}
+				meta, err := c.meta(src, info)
+				if err != nil {
+					return err
+				}
+				e.Type = "script"
+				copied := *meta
+				e.ScriptMeta = &copied
+			}
+			e.Path = absPath(src)
+
+			entries = append(entries, e)
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(parent); err != nil {
+		return err
+	}
+
+	if err := c.save(false); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
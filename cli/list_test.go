@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-list")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "deploy"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "deploy", "README"), []byte("Deploys things\n"), 0644))
+	writeScript(t, filepath.Join(dir, "deploy"), "web", "#!/bin/sh\n# web: Deploys the web app.\n# usage: web <env>\n# example: web prod\n")
+	writeScript(t, dir, "top", "#!/bin/sh\n# top: At the top.\n")
+
+	cmds, err := visitDir(nil, dir, nil)
+	assert.NoError(t, err)
+
+	s := &sd{root: &cobra.Command{Use: "sd"}, noCache: true}
+	s.initList()
+	for _, c := range cmds {
+		setRoot(c, dir)
+	}
+	mergeCommands(s.root, cmds)
+
+	list, _, err := s.root.Find([]string{"list"})
+	assert.NoError(t, err)
+
+	run := func(args ...string) (string, error) {
+		defer list.Flags().Set("format", "tree")
+
+		var out bytes.Buffer
+		s.root.SetOut(&out)
+		s.root.SetErr(&bytes.Buffer{})
+		s.root.SetArgs(append([]string{"list"}, args...))
+		err := s.root.Execute()
+		return out.String(), err
+	}
+
+	t.Run("tree", func(t *testing.T) {
+		out, err := run()
+		assert.NoError(t, err)
+		assert.Equal(t, "deploy  Deploys things\n  web   Deploys the web app.\ntop     At the top.\n", out)
+	})
+
+	t.Run("flat", func(t *testing.T) {
+		out, err := run("--format", "flat")
+		assert.NoError(t, err)
+		assert.Equal(t, "deploy web\ntop\n", out)
+	})
+
+	t.Run("subtree", func(t *testing.T) {
+		out, err := run("deploy", "--format", "flat")
+		assert.NoError(t, err)
+		assert.Equal(t, "deploy web\n", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := run("--format", "json")
+		assert.NoError(t, err)
+
+		var entries []listEntry
+		assert.NoError(t, json.Unmarshal([]byte(out), &entries))
+		assert.Len(t, entries, 3)
+
+		assert.Equal(t, "deploy", entries[0].Command)
+		assert.Equal(t, "directory", entries[0].Type)
+		assert.Equal(t, "Deploys things", entries[0].Short)
+		assert.Equal(t, filepath.Join(dir, "deploy"), entries[0].Path)
+		assert.Equal(t, dir, entries[0].Root)
+
+		assert.Equal(t, "deploy web", entries[1].Command)
+		assert.Equal(t, "script", entries[1].Type)
+		assert.Equal(t, "web <env>", entries[1].Usage)
+		assert.Equal(t, []scriptExample{{Command: "web prod"}}, entries[1].Examples)
+		assert.Equal(t, filepath.Join(dir, "deploy", "web"), entries[1].Path)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := run("--format", "yaml")
+		assert.Equal(t, ExitUsage, ExitCode(err))
+	})
+}
@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// directory under ~/.sd holding user-defined templates for "sd new", named
+// after the language they're for
+const templatesDir = ".templates"
+
+// templates for "sd new", unless overridden in templatesDir
+var scriptTemplates = map[string]string{
+	"bash": `#!/usr/bin/env bash
+#
+# {{.Name}}: {{.Short}}
+{{- if .Usage}}
+# usage: {{.Usage}}
+{{- end}}
+#
+set -euo pipefail
+
+echo "{{.Command}} called with: $*"
+`,
+	"python": `#!/usr/bin/env python3
+#
+# {{.Name}}: {{.Short}}
+{{- if .Usage}}
+# usage: {{.Usage}}
+{{- end}}
+#
+import sys
+
+print("{{.Command}} called with:", sys.argv[1:])
+`,
+	"node": `#!/usr/bin/env node
+//
+// {{.Name}}: {{.Short}}
+{{- if .Usage}}
+// usage: {{.Usage}}
+{{- end}}
+//
+console.log("{{.Command}} called with:", process.argv.slice(2));
+`,
+}
+
+// newScript is what templates get to fill in the header of a new script
+type newScript struct {
+	Name    string
+	Short   string
+	Usage   string
+	Command string
+}
+
+func (s *sd) initNew() {
+	c := &cobra.Command{
+		Use:   "new command...",
+		Short: "Create a new script",
+		Long: `Create a new script, along with any directories leading to it, with a header
+documenting it and the executable bit set.
+
+Scripts are written from a template for the given language. Templates in
+~/.sd/.templates, named after their language, override the built-in ones.`,
+		Example: `  sd new deploy web --usage "web <env> [svc]"
+  sd new db dump --lang python --short "Dumps the database" --edit`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			src, err := newCommand(cmd, args)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), src)
+
+			edit, err := cmd.Root().PersistentFlags().GetBool("edit")
+			if err != nil {
+				return err
+			}
+			if edit {
+				return editFile(src)
+			}
+			return nil
+		},
+	}
+
+	c.Flags().String("source", filepath.Join(os.Getenv("HOME"), ".sd"), "Source directory to create the script in")
+	c.Flags().String("lang", "bash", "Language of the script: bash, python, node or any in ~/.sd/.templates")
+	c.Flags().String("usage", "", "Usage line for the script, e.g. \"bar <env> [svc]\"")
+	c.Flags().String("short", "", "Short description of the script")
+
+	s.root.AddCommand(c)
+}
+
+/*
+ * newCommand creates the script for the command path in args, and returns
+ * where it was written
+ */
+func newCommand(cmd *cobra.Command, args []string) (string, error) {
+	source, _ := cmd.Flags().GetString("source")
+	lang, _ := cmd.Flags().GetString("lang")
+	usage, _ := cmd.Flags().GetString("usage")
+	short, _ := cmd.Flags().GetString("short")
+
+	for _, a := range args {
+		if a == "" || strings.HasPrefix(a, ".") || strings.ContainsRune(a, filepath.Separator) {
+			return "", withCode(ExitUsage, fmt.Errorf("invalid command name %q", a))
+		}
+	}
+
+	tmpl, err := scriptTemplate(lang)
+	if err != nil {
+		return "", err
+	}
+
+	name := args[len(args)-1]
+	usage = strings.TrimSpace(usage)
+	if usage != "" && strings.Fields(usage)[0] != name {
+		usage = name + " " + usage
+	}
+	if short == "" {
+		short = fmt.Sprintf("Does %s things.", name)
+	}
+
+	src := filepath.Join(append([]string{source}, args...)...)
+	if _, err := os.Lstat(src); err == nil {
+		return "", fmt.Errorf("%s already exists", src)
+	}
+
+	if err := makeDirs(source, args[:len(args)-1]); err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(src, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = tmpl.Execute(file, newScript{
+		Name:    name,
+		Short:   short,
+		Usage:   usage,
+		Command: strings.Join(append([]string{cmd.Root().Name()}, args...), " "),
+	})
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(src)
+		return "", err
+	}
+
+	logrus.Debug("Created script: ", src)
+	return src, nil
+}
+
+/*
+ * scriptTemplate returns the template for lang, preferring the user's own
+ */
+func scriptTemplate(lang string) (*template.Template, error) {
+	dir := filepath.Join(os.Getenv("HOME"), ".sd", templatesDir)
+	path := filepath.Join(dir, lang)
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		logrus.Debug("Using template at: ", path)
+		return template.New(lang).Parse(string(data))
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	text, ok := scriptTemplates[lang]
+	if !ok {
+		return nil, withCode(ExitUsage, fmt.Errorf("unknown language %q, expected one of: %s", lang, strings.Join(templateLangs(dir), ", ")))
+	}
+	return template.New(lang).Parse(text)
+}
+
+// templateLangs lists the languages there are templates for
+func templateLangs(dir string) []string {
+	langs := []string{}
+	for lang := range scriptTemplates {
+		langs = append(langs, lang)
+	}
+	if items, err := ioutil.ReadDir(dir); err == nil {
+		for _, i := range items {
+			if !i.IsDir() && !strings.HasPrefix(i.Name(), ".") {
+				langs = append(langs, i.Name())
+			}
+		}
+	}
+	sort.Strings(langs)
+	return deduplicate(langs)
+}
+
+/*
+ * makeDirs creates the directories in path under source, with a README stub
+ * in each of the ones that didn't exist yet
+ */
+func makeDirs(source string, path []string) error {
+	if err := os.MkdirAll(source, 0755); err != nil {
+		return err
+	}
+
+	dir := source
+	for _, p := range path {
+		dir = filepath.Join(dir, p)
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		logrus.Debug("Creating directory: ", dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		readme := fmt.Sprintf("%s commands\n", p)
+		if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte(readme), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCommand(t *testing.T) {
+	home, err := ioutil.TempDir("", "test-new")
+	assert.NoError(t, err)
+	defer os.RemoveAll(home)
+
+	restore := os.Getenv("HOME")
+	defer os.Setenv("HOME", restore)
+	os.Setenv("HOME", home)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, ".sd", templatesDir), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, ".sd", templatesDir, "ruby"), []byte("#!/usr/bin/env ruby\n# {{.Name}}: {{.Short}}\n"), 0644))
+
+	var tests = []struct {
+		name     string
+		args     []string
+		flags    map[string]string
+		path     string
+		expected string
+		err      int
+	}{
+		{
+			"bash by default",
+			[]string{"foo", "bar"},
+			map[string]string{"usage": "bar <env> [svc]"},
+			"foo/bar",
+			"#!/usr/bin/env bash\n#\n# bar: Does bar things.\n# usage: bar <env> [svc]\n#\nset -euo pipefail\n\necho \"sd foo bar called with: $*\"\n",
+			-1,
+		},
+		{
+			"adds the name to the usage",
+			[]string{"baz"},
+			map[string]string{"usage": "<env>", "lang": "python", "short": "Bazzes."},
+			"baz",
+			"#!/usr/bin/env python3\n#\n# baz: Bazzes.\n# usage: baz <env>\n#\nimport sys\n\nprint(\"sd baz called with:\", sys.argv[1:])\n",
+			-1,
+		},
+		{
+			"node comments",
+			[]string{"foo", "quux"},
+			map[string]string{"lang": "node"},
+			"foo/quux",
+			"#!/usr/bin/env node\n//\n// quux: Does quux things.\n//\nconsole.log(\"sd foo quux called with:\", process.argv.slice(2));\n",
+			-1,
+		},
+		{
+			"user templates",
+			[]string{"gem"},
+			map[string]string{"lang": "ruby"},
+			"gem",
+			"#!/usr/bin/env ruby\n# gem: Does gem things.\n",
+			-1,
+		},
+		{"unknown language", []string{"nope"}, map[string]string{"lang": "cobol"}, "", "", ExitUsage},
+		{"hidden names", []string{".nope"}, nil, "", "", ExitUsage},
+		{"already exists", []string{"foo", "bar"}, nil, "", "", ExitFailure},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &sd{root: &cobra.Command{Use: "sd"}}
+			s.initEditing()
+			s.initNew()
+
+			c, _, err := s.root.Find([]string{"new"})
+			assert.NoError(t, err)
+			for k, v := range test.flags {
+				assert.NoError(t, c.Flags().Set(k, v))
+			}
+
+			src, err := newCommand(c, test.args)
+			if test.err >= 0 {
+				assert.Equal(t, test.err, ExitCode(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(home, ".sd", test.path), src)
+
+			data, err := ioutil.ReadFile(src)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, string(data))
+
+			info, err := os.Stat(src)
+			assert.NoError(t, err)
+			assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+			meta, err := parseHeader(src)
+			assert.NoError(t, err)
+			assert.Equal(t, test.args[len(test.args)-1], meta.Name)
+			assert.NotEmpty(t, meta.Short)
+		})
+	}
+
+	t.Run("writes README stubs for new directories only", func(t *testing.T) {
+		readme, err := ioutil.ReadFile(filepath.Join(home, ".sd", "foo", "README"))
+		assert.NoError(t, err)
+		assert.Equal(t, "foo commands\n", string(readme))
+
+		_, err = os.Stat(filepath.Join(home, ".sd", "README"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("opens the editor with --edit", func(t *testing.T) {
+		defer func() { syscallExec = syscall.Exec }()
+		var argv []string
+		syscallExec = func(argv0 string, a []string, envv []string) error {
+			argv = a
+			return nil
+		}
+
+		s := &sd{root: &cobra.Command{Use: "sd"}}
+		s.initEditing()
+		s.initNew()
+		s.root.SetOut(&bytes.Buffer{})
+		s.root.SetArgs([]string{"new", "--edit", "--source", filepath.Join(home, "scripts"), "edited"})
+
+		assert.NoError(t, s.root.Execute())
+		assert.Contains(t, argv[2], filepath.Join(home, "scripts", "edited"))
+	})
+}
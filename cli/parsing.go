@@ -6,55 +6,142 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// ScriptMeta is everything sd knows about a script, as documented in the
+// comment block at the top of it
+type ScriptMeta struct {
+	Path     string          `json:"path"`
+	Name     string          `json:"name"`
+	Short    string          `json:"short,omitempty"`
+	Long     string          `json:"long,omitempty"`
+	Usage    string          `json:"usage,omitempty"`
+	Examples []scriptExample `json:"examples,omitempty"`
+	Flags    []scriptFlag    `json:"flags,omitempty"`
+	Env      []envVar        `json:"env,omitempty"`
+	Runner   string          `json:"runner,omitempty"`
+	Prompt   bool            `json:"prompt,omitempty"`
+
+	Complete    string `json:"complete,omitempty"`
+	CompleteTTL string `json:"complete_ttl,omitempty"`
+
+	// caption for the next example, while parsing
+	caption string
+
+	// for sd doctor: lines that were ignored, and the name in what looks like
+	// a short description line meant for another script
+	problems []string
+	misnamed string
+}
+
+// scriptExample is an "# example:" line, along with the "# example-desc:"
+// line preceding it, if any
+type scriptExample struct {
+	Command string `json:"command"`
+	Caption string `json:"caption,omitempty"`
+}
+
 /*
 
-Looks for a line like this:
+Header keys, other than the name of the file itself, and how to handle them:
 
 # name-of-the-file: short description.
+# usage: foo [arg1] [arg2]
+# example-desc: Does something with 1, 2 and 3
+# example: foo bar 1 2 3
+# flag: -v, --verbose  Be chatty
+# env: AWS_PROFILE (required) Profile to use
+# runner: child
+# prompt: true
+# complete: kubectl get pods -o name
+# complete-ttl: 30s
+
+Also, "# description:" starts a block of comments that make up the long
+description of the script.
 
 */
-func shortDescriptionFrom(path string) (string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		err = file.Close()
+var headerKeys = map[string]func(m *ScriptMeta, value string) error{
+	"usage": func(m *ScriptMeta, value string) error {
+		if m.Usage == "" {
+			m.Usage = value
+		}
+		return nil
+	},
+	"example-desc": func(m *ScriptMeta, value string) error {
+		m.caption = value
+		return nil
+	},
+	"example": func(m *ScriptMeta, value string) error {
+		m.Examples = append(m.Examples, scriptExample{Command: value, Caption: m.caption})
+		m.caption = ""
+		return nil
+	},
+	"flag": func(m *ScriptMeta, value string) error {
+		f, err := parseFlag(value)
 		if err != nil {
-			logrus.Error(err)
+			return err
 		}
-	}()
-
-	r := regexp.MustCompile(fmt.Sprintf(`^# %s: (.*)$`, regexp.QuoteMeta(filepath.Base(path))))
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		match := r.FindStringSubmatch(scanner.Text())
-		if len(match) == 2 {
-			logrus.Debug("Found short description line: ", filepath.Join(path), ", set to: ", match[1])
-			return match[1], nil
+		for _, declared := range m.Flags {
+			if declared.Name == f.Name || (f.Shorthand != "" && declared.Shorthand == f.Shorthand) {
+				return fmt.Errorf("flag %q is declared more than once", value)
+			}
 		}
-	}
-	return "", nil
+		m.Flags = append(m.Flags, f)
+		return nil
+	},
+	"env": func(m *ScriptMeta, value string) error {
+		v, err := parseEnvVar(value)
+		if err != nil {
+			return err
+		}
+		m.Env = append(m.Env, v)
+		return nil
+	},
+	"runner": func(m *ScriptMeta, value string) error {
+		if value != runnerExec && value != runnerChild {
+			return fmt.Errorf("unknown runner %q", value)
+		}
+		m.Runner = value
+		return nil
+	},
+	"prompt": func(m *ScriptMeta, value string) error {
+		prompt, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		m.Prompt = prompt
+		return nil
+	},
+	"complete": func(m *ScriptMeta, value string) error {
+		m.Complete = value
+		return nil
+	},
+	"complete-ttl": func(m *ScriptMeta, value string) error {
+		if _, err := time.ParseDuration(value); err != nil {
+			return err
+		}
+		m.CompleteTTL = value
+		return nil
+	},
 }
 
 /*
 
-Looks for lines like this:
-
-# usage: foo arg1 arg2
-# usage: foo [arg1] [arg2]
+Reads the comment block at the top of a script in a single pass, stopping at
+the first line of actual code. Comments can be in whatever syntax the script's
+language uses, as long as sd knows about it (see commentStyle).
 
 */
-func usageFrom(path string) (string, cobra.PositionalArgs, error) {
+func parseHeader(path string) (*ScriptMeta, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return "", cobra.ArbitraryArgs, err
+		return nil, err
 	}
 	defer func() {
 		err = file.Close()
@@ -63,72 +150,291 @@ func usageFrom(path string) (string, cobra.PositionalArgs, error) {
 		}
 	}()
 
-	r := regexp.MustCompile(`^# usage: (.*)$`)
+	m := &ScriptMeta{
+		Path: path,
+		Name: filepath.Base(path),
+	}
+
+	// the long description is either an explicit "# description:" block, or
+	// the rest of the comments that follow the first key, up to a blank line
+	var (
+		seenKey, ended, describing, described bool
+		implicit, explicit                    []string
+	)
+
+	var style *commentStyle
+
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		match := r.FindStringSubmatch(scanner.Text())
-		if len(match) == 2 {
-			line := match[1]
-			logrus.Debug("Found usage line: ", filepath.Join(path), ", set to: ", line)
-
-			parts := strings.Split(line, " ")
-			if len(parts) == 1 {
-				logrus.Debug("No args allowed")
-				return line, cobra.NoArgs, nil
+		line := scanner.Text()
+		blank := strings.TrimSpace(line) == ""
+
+		if style == nil && !blank {
+			style = detectCommentStyle(line)
+			logrus.Debug("Comments in ", path, " start with: ", style.leader)
+			if strings.HasPrefix(line, "#!") {
+				continue
 			}
+		}
+
+		if blank && (style == nil || !style.inBlock) {
+			ended = seenKey
+			describing = false
+			continue
+		}
+
+		line, ok := style.uncomment(line)
+		if !ok {
+			break
+		}
+
+		if key, value, ok := headerKey(m.Name, line); ok {
+			seenKey = true
+			describing = key == "description"
 
-			var required, optional int
-			for _, i := range parts[1:] {
-				if i == "..." {
-					continue
+			switch {
+			case describing:
+				described = true
+				explicit = append(explicit, value)
+
+			case key == m.Name:
+				if m.Short == "" {
+					logrus.Debug("Found short description line: ", path, ", set to: ", value)
+					m.Short = value
 				}
-				if strings.HasPrefix(i, "[") && strings.HasSuffix(i, "]") {
-					logrus.Debug("Found optional arg: ", i)
-					optional++
-				} else {
-					logrus.Debug("Found required arg: ", i)
-					required++
+
+			default:
+				logrus.Debug("Found ", key, " line: ", path, ", set to: ", value)
+				if err := headerKeys[key](m, value); err != nil {
+					logrus.Debug("Ignoring ", key, " line in ", path, ": ", err)
+					m.problems = append(m.problems, fmt.Sprintf("ignoring %s line: %v", key, err))
 				}
 			}
-			if parts[len(parts)-1] == "..." {
-				logrus.Debug("Minimum of ", required, " arguments set")
-				return match[1], cobra.MinimumNArgs(required), nil
-			}
-			logrus.Debug("Arg range of ", required, " and ", required+optional, " set")
-			return match[1], cobra.RangeArgs(required, required+optional), nil
+			continue
 		}
+
+		if match := nameLine.FindStringSubmatch(line); match != nil && !seenKey && m.misnamed == "" && scriptName(path, match[1]) {
+			m.misnamed = match[1]
+		}
+
+		text := strings.TrimPrefix(strings.TrimPrefix(line, "#"), " ")
+		switch {
+		case describing:
+			explicit = append(explicit, text)
+		case seenKey && !ended:
+			implicit = append(implicit, text)
+		}
+	}
+
+	if m.Short != "" {
+		m.misnamed = ""
+	}
+
+	if described {
+		m.Long = trimBlankLines(explicit)
+	} else {
+		m.Long = trimBlankLines(implicit)
 	}
-	logrus.Debug("Any args allowed")
-	return filepath.Base(path), cobra.ArbitraryArgs, nil
+	return m, scanner.Err()
 }
 
+var nameLine = regexp.MustCompile(`^# ([\w.-]+): \S`)
+
 /*
+ * scriptName tells whether name looks like it's the name of a script rather
+ * than any other "# Note: ..." comment: either there's a file by that name
+ * next to the script at path, or it's the script's own name give or take an
+ * extension
+ */
+func scriptName(path string, name string) bool {
+	base := filepath.Base(path)
+	if strings.TrimSuffix(name, filepath.Ext(name)) == base || strings.TrimSuffix(base, filepath.Ext(base)) == name {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(filepath.Dir(path), name))
+	return err == nil
+}
 
-Looks for a line like this:
+/*
+ * headerKey splits lines like "# key: value", as long as key is one sd knows
+ * about. Anything else is just a comment.
+ */
+func headerKey(name string, line string) (string, string, bool) {
+	i := strings.Index(line, ": ")
+	if !strings.HasPrefix(line, "# ") || i < 0 {
+		return "", "", false
+	}
 
-# example: foo bar 1 2 3
+	key, value := line[2:i], line[i+2:]
+	if _, ok := headerKeys[key]; ok || key == name || key == "description" {
+		return key, value, true
+	}
+	return "", "", false
+}
+
+/*
+
+Turns usage lines like these into cobra's Use and Args:
+
+# usage: foo arg1 arg2
+# usage: foo [arg1] [arg2]
+# usage: foo arg1 ...
 
 */
-func exampleFrom(path string) (string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return "", err
+func parseUsage(name string, line string) (string, cobra.PositionalArgs) {
+	if line == "" {
+		logrus.Debug("Any args allowed")
+		return name, cobra.ArbitraryArgs
 	}
-	defer func() {
-		err = file.Close()
-		if err != nil {
-			logrus.Error(err)
+
+	parts := usageFields(line)
+	if len(parts) == 1 {
+		logrus.Debug("No args allowed")
+		return line, cobra.NoArgs
+	}
+
+	var required, optional int
+	for _, i := range parts[1:] {
+		if i == "..." {
+			continue
 		}
-	}()
+		if parseUsageArg(i).Optional {
+			logrus.Debug("Found optional arg: ", i)
+			optional++
+		} else {
+			logrus.Debug("Found required arg: ", i)
+			required++
+		}
+	}
+	if parts[len(parts)-1] == "..." {
+		logrus.Debug("Minimum of ", required, " arguments set")
+		return line, cobra.MinimumNArgs(required)
+	}
+	logrus.Debug("Arg range of ", required, " and ", required+optional, " set")
+	return line, cobra.RangeArgs(required, required+optional)
+}
 
-	r := regexp.MustCompile(`^# example: (.*)$`)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		match := r.FindStringSubmatch(scanner.Text())
-		if len(match) == 2 {
-			logrus.Debug("Found example line: ", filepath.Join(path), ", set to: ", match[1])
-			return fmt.Sprintf("  %s", match[1]), nil
+// scriptFlag describes a flag declared in a script header
+type scriptFlag struct {
+	Name        string `json:"name"`
+	Shorthand   string `json:"shorthand,omitempty"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// reservedFlags can't be redeclared by scripts, as sd itself uses them
+var reservedFlags = map[string]bool{
+	"help": true, "h": true,
+	"debug": true, "d": true,
+	"edit": true, "e": true,
+	"alias": true, "a": true,
+	"no-cache": true,
+	"runner":   true,
+	"prompt":   true,
+	"root":     true,
+}
+
+var flagRegexp = regexp.MustCompile(`^(?:-(\w), )?--(\w[\w-]*)(?: (bool|string|int))?(?:=(\S*))?(?:\s+(.*))?$`)
+
+/*
+
+Parses flag declarations like these:
+
+-v, --verbose  Be chatty
+--env string=staging  Environment to deploy to
+-n, --count int=1  How many times to do it
+
+The type is one of bool (the default), string or int.
+
+*/
+func parseFlag(spec string) (scriptFlag, error) {
+	match := flagRegexp.FindStringSubmatch(strings.TrimSpace(spec))
+	if match == nil {
+		return scriptFlag{}, fmt.Errorf("malformed flag: %q", spec)
+	}
+
+	f := scriptFlag{
+		Shorthand:   match[1],
+		Name:        match[2],
+		Type:        match[3],
+		Default:     match[4],
+		Description: strings.TrimSpace(match[5]),
+	}
+	if f.Type == "" {
+		f.Type = "bool"
+	}
+
+	if reservedFlags[f.Name] || reservedFlags[f.Shorthand] {
+		return scriptFlag{}, fmt.Errorf("flag %q is reserved by sd", spec)
+	}
+
+	switch f.Type {
+	case "bool":
+		if f.Default == "" {
+			f.Default = "false"
+		}
+		if _, err := strconv.ParseBool(f.Default); err != nil {
+			return scriptFlag{}, fmt.Errorf("invalid default for --%s: %v", f.Name, err)
+		}
+	case "int":
+		if f.Default == "" {
+			f.Default = "0"
+		}
+		if _, err := strconv.Atoi(f.Default); err != nil {
+			return scriptFlag{}, fmt.Errorf("invalid default for --%s: %v", f.Name, err)
 		}
 	}
-	return "", nil
+	return f, nil
+}
+
+// envName is the environment variable a flag's value is handed to the script in
+func (f scriptFlag) envName() string {
+	return "SD_FLAG_" + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+}
+
+// envVar describes an environment variable documented in a script header
+type envVar struct {
+	Name        string `json:"name"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+var envVarRegexp = regexp.MustCompile(`^([A-Za-z_]\w*)(?:=(\S*))?(\s+\(required\))?(?:\s+(.*))?$`)
+
+/*
+
+Parses environment variable declarations like these:
+
+AWS_PROFILE (required) Profile to use
+AWS_REGION=us-east-1 Region to use
+
+*/
+func parseEnvVar(spec string) (envVar, error) {
+	match := envVarRegexp.FindStringSubmatch(strings.TrimSpace(spec))
+	if match == nil {
+		return envVar{}, fmt.Errorf("malformed env: %q", spec)
+	}
+	return envVar{
+		Name:        match[1],
+		Default:     match[2],
+		Required:    match[3] != "",
+		Description: strings.TrimSpace(match[4]),
+	}, nil
+}
+
+// String formats the variable back the way it's declared in a header
+func (v envVar) String() string {
+	s := v.Name
+	if v.Default != "" {
+		s += "=" + v.Default
+	}
+	if v.Required {
+		s += " (required)"
+	}
+	if v.Description != "" {
+		s += " " + v.Description
+	}
+	return s
 }
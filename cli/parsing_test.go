@@ -1,17 +1,63 @@
 package cli
 
 import (
+	"bufio"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestShortDescriptionFrom(t *testing.T) {
+func TestParseHeader(t *testing.T) {
+	t.Run("reads the whole header", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "test-parse-header")
+		assert.NoError(t, err)
+
+		name := filepath.Base(f.Name())
+		f.WriteString(fmt.Sprintf("#!/bin/sh\n\n# %s: blah\n# usage: %s foo\n# example: %s 1\n#\n\necho hi\n", name, name, name))
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+
+		m, err := parseHeader(f.Name())
+		assert.NoError(t, err)
+		assert.Equal(t, &ScriptMeta{
+			Path:     f.Name(),
+			Name:     name,
+			Short:    "blah",
+			Usage:    name + " foo",
+			Examples: []scriptExample{{Command: name + " 1"}},
+		}, m)
+	})
+
+	t.Run("stops at the first line of code", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "test-parse-header")
+		assert.NoError(t, err)
+
+		f.WriteString("#!/bin/sh\nset -e\n# usage: foo bar\n")
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+
+		m, err := parseHeader(f.Name())
+		assert.NoError(t, err)
+		assert.Equal(t, "", m.Usage)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := parseHeader("/does/not/exist")
+		assert.Error(t, err)
+	})
+}
+
+func TestParseHeaderShortDescription(t *testing.T) {
 	var tests = []struct {
 		name        string
 		inputFormat string
@@ -45,14 +91,14 @@ func TestShortDescriptionFrom(t *testing.T) {
 				os.Remove(f.Name())
 			}()
 
-			v, err := shortDescriptionFrom(f.Name())
+			m, err := parseHeader(f.Name())
 			assert.NoError(t, err)
-			assert.Equal(t, test.expected, v)
+			assert.Equal(t, test.expected, m.Short)
 		})
 	}
 }
 
-func TestUsageFrom(t *testing.T) {
+func TestParseUsage(t *testing.T) {
 	var tests = []struct {
 		name       string
 		input      string
@@ -71,6 +117,19 @@ func TestUsageFrom(t *testing.T) {
 				assert.Error(t, v(&cobra.Command{}, []string{"first", "second"}))
 			},
 		},
+		{
+			"extra spaces",
+			"#\n# usage: blah  foo   [bar]\n#\n",
+			func(t *testing.T, name string, actual string) {
+				assert.Equal(t, "blah  foo   [bar]", actual)
+			},
+			func(t *testing.T, v cobra.PositionalArgs) {
+				assert.Error(t, v(&cobra.Command{}, []string{}))
+				assert.NoError(t, v(&cobra.Command{}, []string{"first"}))
+				assert.NoError(t, v(&cobra.Command{}, []string{"first", "second"}))
+				assert.Error(t, v(&cobra.Command{}, []string{"first", "second", "third"}))
+			},
+		},
 		{
 			"mandatory argument",
 			"#\n# usage: blah foo\n#\n",
@@ -187,34 +246,50 @@ func TestUsageFrom(t *testing.T) {
 				_ = os.Remove(f.Name())
 			}()
 
-			usage, args, err := usageFrom(f.Name())
+			m, err := parseHeader(f.Name())
 			assert.NoError(t, err)
+
+			usage, args := parseUsage(m.Name, m.Usage)
 			test.checkUsage(t, filepath.Base(f.Name()), usage)
 			test.checkArgs(t, args)
 		})
 	}
 }
 
-func TestExampleFrom(t *testing.T) {
+func TestParseHeaderExamples(t *testing.T) {
 	var tests = []struct {
 		name     string
 		input    string
-		expected string
+		expected []scriptExample
 	}{
 		{
 			"happy path",
 			"#\n# example: blah\n#\n",
-			"  blah",
+			[]scriptExample{{Command: "blah"}},
+		},
+		{
+			"multiple",
+			"#\n# example: blah\n# example: bleh\n#\n",
+			[]scriptExample{{Command: "blah"}, {Command: "bleh"}},
+		},
+		{
+			"captions",
+			"#\n# example-desc: Blahs\n# example: blah\n# example: bleh\n# example-desc: Blohs\n# example: bloh\n#\n",
+			[]scriptExample{
+				{Command: "blah", Caption: "Blahs"},
+				{Command: "bleh"},
+				{Command: "bloh", Caption: "Blohs"},
+			},
 		},
 		{
 			"missing",
 			"#\n#\n#\n",
-			"",
+			nil,
 		},
 		{
 			"no input",
 			"",
-			"",
+			nil,
 		},
 	}
 
@@ -229,9 +304,309 @@ func TestExampleFrom(t *testing.T) {
 				_ = os.Remove(f.Name())
 			}()
 
-			v, err := exampleFrom(f.Name())
+			m, err := parseHeader(f.Name())
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, m.Examples)
+		})
+	}
+}
+
+func TestParseHeaderFlags(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected []scriptFlag
+	}{
+		{
+			"bool flag",
+			"#\n# flag: -v, --verbose  Be chatty\n#\n",
+			[]scriptFlag{{Name: "verbose", Shorthand: "v", Type: "bool", Default: "false", Description: "Be chatty"}},
+		},
+		{
+			"typed flags with defaults",
+			"#\n# flag: --env string=staging  Environment\n# flag: -n, --count int=3  How many\n#\n",
+			[]scriptFlag{
+				{Name: "env", Type: "string", Default: "staging", Description: "Environment"},
+				{Name: "count", Shorthand: "n", Type: "int", Default: "3", Description: "How many"},
+			},
+		},
+		{
+			"no description",
+			"# flag: --dry-run\n",
+			[]scriptFlag{{Name: "dry-run", Type: "bool", Default: "false"}},
+		},
+		{
+			"ignores malformed and reserved flags",
+			"# flag: verbose\n# flag: -d, --dry-run\n# flag: --help\n# flag: --count int=many\n",
+			nil,
+		},
+		{
+			"ignores flags declared twice",
+			"# flag: -v, --verbose  Be chatty\n# flag: -v, --vapid  Be dull\n# flag: --verbose string  Again\n",
+			[]scriptFlag{{Name: "verbose", Shorthand: "v", Type: "bool", Default: "false", Description: "Be chatty"}},
+		},
+		{
+			"missing",
+			"#\n#\n#\n",
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "test-flags-from")
+			assert.NoError(t, err)
+
+			f.WriteString(test.input)
+			defer func() {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}()
+
+			m, err := parseHeader(f.Name())
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, m.Flags)
+		})
+	}
+}
+
+func TestParseHeaderDuplicateFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-parse-header-duplicate-flags")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := parseHeader(writeScript(t, dir, "foo", "#!/bin/sh\n# foo: blah\n# flag: -v, --verbose\n# flag: -v, --vapid\n# flag: --verbose string\n"))
+	assert.NoError(t, err)
+	assert.Len(t, m.Flags, 1)
+	assert.Equal(t, []string{
+		`ignoring flag line: flag "-v, --vapid" is declared more than once`,
+		`ignoring flag line: flag "--verbose string" is declared more than once`,
+	}, m.problems)
+}
+
+func TestParseHeaderMisnamed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-parse-header-misnamed")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeScript(t, dir, "other", "#!/bin/sh\n")
+
+	var tests = []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"other extension", "# bar.sh: Bars.\n", "bar.sh"},
+		{"script next to it", "# other: Others.\n", "other"},
+		{"note", "# Note: this is a comment.\n", ""},
+		{"copyright", "# Copyright: ACME\n", ""},
+		{"has a description", "# Note: this is a comment.\n# bar: Bars.\n", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := parseHeader(writeScript(t, dir, "bar", "#!/bin/sh\n"+test.header))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, m.misnamed)
+		})
+	}
+}
+
+func TestParseHeaderEnv(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected []envVar
+	}{
+		{
+			"required",
+			"#\n# env: AWS_PROFILE (required) Profile to use\n#\n",
+			[]envVar{{Name: "AWS_PROFILE", Required: true, Description: "Profile to use"}},
+		},
+		{
+			"default",
+			"#\n# env: AWS_REGION=us-east-1 Region to use\n#\n",
+			[]envVar{{Name: "AWS_REGION", Default: "us-east-1", Description: "Region to use"}},
+		},
+		{
+			"name only",
+			"# env: FOO\n",
+			[]envVar{{Name: "FOO"}},
+		},
+		{
+			"ignores malformed lines",
+			"# env: 1FOO\n# env: \n",
+			nil,
+		},
+		{
+			"missing",
+			"#\n#\n#\n",
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "test-env-from")
+			assert.NoError(t, err)
+
+			f.WriteString(test.input)
+			defer func() {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}()
+
+			m, err := parseHeader(f.Name())
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, m.Env)
+		})
+	}
+}
+
+func benchmarkScript(b *testing.B) string {
+	f, err := ioutil.TempFile("", "bench-parse-header")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	name := filepath.Base(f.Name())
+	fmt.Fprintf(f, "#!/bin/sh\n#\n# %s: blah\n# usage: %s foo [bar]\n# example: %s 1 2\n#\n", name, name, name)
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(f, "echo \"line %d of a reasonably long script body\"\n", i)
+	}
+	if err := f.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return f.Name()
+}
+
+func BenchmarkParseHeader(b *testing.B) {
+	path := benchmarkScript(b)
+	defer os.Remove(path)
+
+	b.Run("single pass", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := parseHeader(path); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// what parsing used to cost: one full scan and regexp per key
+	b.Run("full scan per key", func(b *testing.B) {
+		patterns := []string{
+			fmt.Sprintf(`^# %s: (.*)$`, regexp.QuoteMeta(filepath.Base(path))),
+			`^# usage: (.*)$`,
+			`^# example: (.*)$`,
+		}
+		for i := 0; i < b.N; i++ {
+			for _, p := range patterns {
+				r := regexp.MustCompile(p)
+				f, err := os.Open(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				scanner := bufio.NewScanner(f)
+				for scanner.Scan() {
+					r.FindStringSubmatch(scanner.Text())
+				}
+				f.Close()
+			}
+		}
+	})
+}
+
+func TestParseHeaderLong(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"comments following the keys",
+			"#!/bin/sh\n# foo: blah\n# usage: foo\n#\n# First paragraph,\n# still first.\n#\n# Second paragraph.\n#   indented\n#\n\n# not part of it\necho\n",
+			"First paragraph,\nstill first.\n\nSecond paragraph.\n  indented",
+		},
+		{
+			"keys in between",
+			"# foo: blah\n#\n# Some text.\n#\n# example: foo 1\n",
+			"Some text.",
+		},
+		{
+			"description block",
+			"# foo: blah\n# Ignored.\n# description: First line,\n# second line.\n#\n# More.\n# usage: foo\n# Also ignored.\n",
+			"First line,\nsecond line.\n\nMore.",
+		},
+		{
+			"comments before the keys",
+			"#!/bin/sh\n# Copyright someone\n#\n# foo: blah\n",
+			"",
+		},
+		{
+			"missing",
+			"#\n#\n#\n",
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "test-parse-header-long")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "foo")
+			assert.NoError(t, ioutil.WriteFile(path, []byte(test.input), 0755))
+
+			m, err := parseHeader(path)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, m.Long)
+		})
+	}
+}
+
+func TestParseHeaderCommentStyles(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+	}{
+		{
+			"node",
+			"#!/usr/bin/env node\n//\n// foo: blah\n// usage: foo bar\n// example: foo 1\n//\n// Longer text.\nconsole.log('hi')\n// example: not in the header\n",
+		},
+		{
+			"lua",
+			"#!/usr/bin/env lua\n-- foo: blah\n-- usage: foo bar\n-- example: foo 1\n--\n-- Longer text.\nprint('hi')\n",
+		},
+		{
+			"sql without a shebang",
+			"-- foo: blah\n-- usage: foo bar\n-- example: foo 1\n--\n-- Longer text.\nSELECT 1;\n",
+		},
+		{
+			"lisp",
+			"#!/usr/bin/env sbcl --script\n;;; foo: blah\n;; usage: foo bar\n;; example: foo 1\n;;\n;; Longer text.\n(print 1)\n",
+		},
+		{
+			"block comments",
+			"#!/usr/bin/env node\n/*\n * foo: blah\n * usage: foo bar\n * example: foo 1\n *\n * Longer text.\n */\nconsole.log('hi')\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "test-parse-header-styles")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "foo")
+			assert.NoError(t, ioutil.WriteFile(path, []byte(test.input), 0755))
+
+			m, err := parseHeader(path)
 			assert.NoError(t, err)
-			assert.Equal(t, test.expected, v)
+			assert.Equal(t, "blah", m.Short)
+			assert.Equal(t, "foo bar", m.Usage)
+			assert.Equal(t, []scriptExample{{Command: "foo 1"}}, m.Examples)
+			assert.Equal(t, "Longer text.", m.Long)
 		})
 	}
 }
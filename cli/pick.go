@@ -0,0 +1,334 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// keys the picker handles, as read from a terminal in raw mode
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlH     = 8
+	keyNewline   = 10
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// ANSI escapes used to draw the picker
+const (
+	ansiAltScreen  = "\x1b[?1049h"
+	ansiMainScreen = "\x1b[?1049l"
+	ansiClear      = "\x1b[H\x1b[2J"
+	ansiReverse    = "\x1b[7m"
+)
+
+func (s *sd) initPick() {
+	s.root.AddCommand(&cobra.Command{
+		Use:   "pick [query]",
+		Short: "Pick a command to run from a fuzzy finder",
+		Long: `Pick a command to run from all the scripts sd knows about, by typing parts of
+their names or descriptions. Up and down (or Ctrl-P and Ctrl-N) move through the
+matches, Enter runs the one selected and Esc or Ctrl-C quits.
+
+Once picked, sd asks for any required arguments of the command before running
+it, as if it had been typed in.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !isTerminal(int(os.Stdin.Fd())) || !isTerminal(int(os.Stdout.Fd())) {
+				return withCode(ExitUsage, fmt.Errorf("%s needs a terminal", cmd.CommandPath()))
+			}
+
+			items := pickItems(cmd.Root())
+			if len(items) == 0 {
+				return fmt.Errorf("no commands to pick from")
+			}
+
+			target, err := pick(os.Stdin, os.Stdout, newPicker(items, strings.Join(args, " ")))
+			if err != nil || target == nil {
+				return err
+			}
+
+			values, err := promptArgs(bufio.NewReader(stdin), cmd.ErrOrStderr(), requiredArgs(target.Use))
+			if err != nil {
+				return withCode(ExitUsage, err)
+			}
+
+			line := append(strings.Fields(commandName(target)), values...)
+			fmt.Fprintln(cmd.ErrOrStderr(), cmd.Root().Name(), strings.Join(line, " "))
+
+			// the command reports its own errors
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			cmd.Root().SetArgs(line)
+			return cmd.Root().Execute()
+		},
+	})
+}
+
+// pickItem is a command that can be picked, under the name it's typed as
+type pickItem struct {
+	name string
+	cmd  *cobra.Command
+}
+
+/*
+ * pickItems returns every script loaded under parent, in the order they're
+ * listed in help
+ */
+func pickItems(parent *cobra.Command) []pickItem {
+	var items []pickItem
+	for _, c := range loaded(parent) {
+		if isDir(c) {
+			items = append(items, pickItems(c)...)
+			continue
+		}
+		items = append(items, pickItem{name: commandName(c), cmd: c})
+	}
+	return items
+}
+
+/*
+ * fuzzyScore tells whether every character in query appears in text, in
+ * order, and how far apart they are. Lower scores are better matches.
+ */
+func fuzzyScore(text string, query string) (int, bool) {
+	text, query = strings.ToLower(text), strings.ToLower(query)
+
+	score, pos := 0, -1
+	for _, r := range query {
+		if r == ' ' {
+			continue
+		}
+		i := strings.IndexRune(text[pos+1:], r)
+		if i < 0 {
+			return 0, false
+		}
+		if pos >= 0 {
+			score += i
+		} else {
+			score += i / 4
+		}
+		pos += i + utf8.RuneLen(r)
+	}
+	return score, true
+}
+
+// picker is the state of the fuzzy finder
+type picker struct {
+	items    []pickItem
+	query    string
+	matches  []pickItem
+	selected int
+	offset   int
+}
+
+func newPicker(items []pickItem, query string) *picker {
+	p := &picker{items: items, query: query}
+	p.filter()
+	return p
+}
+
+/*
+ * filter finds the items matching the query, best first. Matches on names
+ * always come before the ones found in descriptions.
+ */
+func (p *picker) filter() {
+	type scored struct {
+		item  pickItem
+		score int
+	}
+
+	var found []scored
+	for _, i := range p.items {
+		if score, ok := fuzzyScore(i.name, p.query); ok {
+			found = append(found, scored{i, score})
+		} else if score, ok := fuzzyScore(i.name+" "+i.cmd.Short, p.query); ok {
+			found = append(found, scored{i, score + 1000})
+		}
+	}
+	sort.SliceStable(found, func(a, b int) bool {
+		return found[a].score < found[b].score
+	})
+
+	p.matches = nil
+	for _, f := range found {
+		p.matches = append(p.matches, f.item)
+	}
+	p.selected, p.offset = 0, 0
+}
+
+func (p *picker) move(by int) {
+	p.selected += by
+	if p.selected < 0 {
+		p.selected = 0
+	}
+	if p.selected >= len(p.matches) {
+		p.selected = len(p.matches) - 1
+	}
+}
+
+/*
+ * handle updates the picker with keys read from the terminal, and tells
+ * whether picking is done and if something was picked
+ */
+func (p *picker) handle(input []byte) (bool, bool) {
+	query := p.query
+	for i := 0; i < len(input); i++ {
+		switch b := input[i]; {
+		case b == keyEscape && i+2 < len(input) && (input[i+1] == '[' || input[i+1] == 'O'):
+			switch input[i+2] {
+			case 'A':
+				p.move(-1)
+			case 'B':
+				p.move(1)
+			}
+			i += 2
+		case b == keyEscape, b == keyCtrlC, b == keyCtrlD:
+			return true, false
+		case b == keyEnter, b == keyNewline:
+			return true, len(p.matches) > 0
+		case b == keyCtrlP:
+			p.move(-1)
+		case b == keyCtrlN:
+			p.move(1)
+		case b == keyBackspace, b == keyCtrlH:
+			_, size := utf8.DecodeLastRuneInString(p.query)
+			p.query = p.query[:len(p.query)-size]
+		case b == keyCtrlU:
+			p.query = ""
+		case b >= ' ':
+			r, size := utf8.DecodeRune(input[i:])
+			if r != utf8.RuneError {
+				p.query += string(r)
+			}
+			i += size - 1
+		}
+	}
+
+	if p.query != query {
+		p.filter()
+	}
+	return false, false
+}
+
+// picked returns the selected command, if any
+func (p *picker) picked() *cobra.Command {
+	if len(p.matches) == 0 {
+		return nil
+	}
+	return p.matches[p.selected].cmd
+}
+
+/*
+ * render draws the picker: the query, the matches, and a preview of the
+ * usage and examples of the selected one below them
+ */
+func (p *picker) render(w io.Writer, width int, height int) {
+	rows := height / 2
+	if rows < 1 {
+		rows = 1
+	}
+	if p.selected < p.offset {
+		p.offset = p.selected
+	}
+	if p.selected >= p.offset+rows {
+		p.offset = p.selected - rows + 1
+	}
+
+	var lines []string
+	lines = append(lines, "> "+p.query, fmt.Sprintf("  %d/%d", len(p.matches), len(p.items)))
+
+	nameWidth := 0
+	for _, m := range p.matches {
+		if len(m.name) > nameWidth {
+			nameWidth = len(m.name)
+		}
+	}
+	for i := p.offset; i < len(p.matches) && i < p.offset+rows; i++ {
+		m := p.matches[i]
+		line := truncate(fmt.Sprintf("  %-*s  %s", nameWidth, m.name, m.cmd.Short), width)
+		if i == p.selected {
+			line = ansiReverse + line + ansiReset
+		}
+		lines = append(lines, line)
+	}
+
+	if cmd := p.picked(); cmd != nil {
+		lines = append(lines, strings.Repeat("─", width), "Usage: "+cmd.UseLine())
+		if cmd.Long != "" {
+			lines = append(lines, "", cmd.Long)
+		} else if cmd.Short != "" {
+			lines = append(lines, "", cmd.Short)
+		}
+		if cmd.Example != "" {
+			lines = append(lines, "", "Examples:", cmd.Example)
+		}
+	}
+
+	var out []string
+	for _, l := range strings.Split(strings.Join(lines, "\n"), "\n") {
+		if len(out) == height {
+			break
+		}
+		out = append(out, truncate(l, width))
+	}
+	fmt.Fprint(w, ansiClear+strings.Join(out, "\r\n"))
+}
+
+// truncate cuts s down to width characters, leaving escapes alone
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width || strings.Contains(s, "\x1b") {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+/*
+ * pick runs the picker on the terminal until something is picked, returning
+ * nil if nothing was
+ */
+func pick(in *os.File, out *os.File, p *picker) (*cobra.Command, error) {
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	defer term.Restore(int(in.Fd()), state)
+
+	fmt.Fprint(out, ansiAltScreen)
+	defer fmt.Fprint(out, ansiMainScreen)
+
+	buf := make([]byte, 64)
+	for {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		p.render(out, width, height)
+
+		n, err := in.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if done, ok := p.handle(buf[:n]); done {
+			if !ok {
+				logrus.Debug("Nothing picked")
+				return nil, nil
+			}
+			return p.picked(), nil
+		}
+	}
+}
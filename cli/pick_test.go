@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPickItems() []pickItem {
+	root := &cobra.Command{Use: "sd"}
+	deploy := &cobra.Command{Use: "deploy [command]", Annotations: map[string]string{"Source": "/deploy", "Dir": "true"}}
+	deploy.AddCommand(
+		&cobra.Command{Use: "web <env>", Short: "Deploys the web app", Example: "  web prod", Annotations: map[string]string{"Source": "/deploy/web"}},
+		&cobra.Command{Use: "db <env>", Short: "Deploys the database", Annotations: map[string]string{"Source": "/deploy/db"}},
+	)
+	root.AddCommand(deploy, &cobra.Command{Use: "weather", Short: "Checks the weather", Annotations: map[string]string{"Source": "/weather"}})
+	root.AddCommand(&cobra.Command{Use: "list", Short: "Built in"})
+	return pickItems(root)
+}
+
+func names(items []pickItem) []string {
+	var out []string
+	for _, i := range items {
+		out = append(out, i.name)
+	}
+	return out
+}
+
+func TestPickItems(t *testing.T) {
+	assert.Equal(t, []string{"deploy db", "deploy web", "weather"}, names(testPickItems()))
+}
+
+func TestFuzzyScore(t *testing.T) {
+	var tests = []struct {
+		text  string
+		query string
+		ok    bool
+	}{
+		{"deploy web", "", true},
+		{"deploy web", "dw", true},
+		{"deploy web", "DEP WEB", true},
+		{"deploy web", "wd", false},
+		{"deploy web", "x", false},
+	}
+	for _, test := range tests {
+		t.Run(test.text+"/"+test.query, func(t *testing.T) {
+			_, ok := fuzzyScore(test.text, test.query)
+			assert.Equal(t, test.ok, ok)
+		})
+	}
+
+	tight, _ := fuzzyScore("deploy web", "web")
+	loose, _ := fuzzyScore("deploy web", "dyb")
+	assert.True(t, tight < loose)
+}
+
+func TestPicker(t *testing.T) {
+	t.Run("filters as you type", func(t *testing.T) {
+		p := newPicker(testPickItems(), "")
+		assert.Len(t, p.matches, 3)
+
+		p.handle([]byte("we"))
+		assert.Equal(t, []string{"weather", "deploy web"}, names(p.matches))
+
+		p.handle([]byte{keyBackspace, keyBackspace})
+		assert.Len(t, p.matches, 3)
+	})
+
+	t.Run("reads multibyte characters", func(t *testing.T) {
+		p := newPicker([]pickItem{
+			{name: "coffee", cmd: &cobra.Command{Use: "coffee", Short: "Prépare le café"}},
+			{name: "tea", cmd: &cobra.Command{Use: "tea", Short: "Brews tea"}},
+		}, "")
+
+		p.handle([]byte("café"))
+		assert.Equal(t, "café", p.query)
+		assert.Equal(t, []string{"coffee"}, names(p.matches))
+
+		p.handle([]byte{keyBackspace})
+		assert.Equal(t, "caf", p.query)
+	})
+
+	t.Run("matches descriptions after names", func(t *testing.T) {
+		p := newPicker(testPickItems(), "database")
+		assert.Equal(t, []string{"deploy db"}, names(p.matches))
+	})
+
+	t.Run("moves and picks", func(t *testing.T) {
+		p := newPicker(testPickItems(), "")
+		done, _ := p.handle([]byte("\x1b[B\x1b[B\x1b[B"))
+		assert.False(t, done)
+		assert.Equal(t, "weather", p.picked().Name())
+
+		p.handle([]byte{keyCtrlP})
+		assert.Equal(t, "web", p.picked().Name())
+
+		done, ok := p.handle([]byte{keyEnter})
+		assert.True(t, done)
+		assert.True(t, ok)
+	})
+
+	t.Run("cancels", func(t *testing.T) {
+		for _, key := range []byte{keyEscape, keyCtrlC, keyCtrlD} {
+			done, ok := newPicker(testPickItems(), "").handle([]byte{key})
+			assert.True(t, done)
+			assert.False(t, ok)
+		}
+	})
+
+	t.Run("picks nothing without matches", func(t *testing.T) {
+		p := newPicker(testPickItems(), "zzz")
+		done, ok := p.handle([]byte{keyEnter})
+		assert.True(t, done)
+		assert.False(t, ok)
+		assert.Nil(t, p.picked())
+	})
+
+	t.Run("renders matches and a preview", func(t *testing.T) {
+		p := newPicker(testPickItems(), "web")
+		var out bytes.Buffer
+		p.render(&out, 40, 20)
+
+		lines := strings.Split(strings.TrimPrefix(out.String(), ansiClear), "\r\n")
+		assert.Equal(t, "> web", lines[0])
+		assert.Equal(t, "  1/3", lines[1])
+		assert.Equal(t, ansiReverse+"  deploy web  Deploys the web app"+ansiReset, lines[2])
+		assert.Contains(t, lines, "Usage: sd deploy web <env>")
+		assert.Contains(t, lines, "  web prod")
+	})
+}
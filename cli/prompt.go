@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// these get mocked in tests
+var (
+	stdin      io.Reader = os.Stdin
+	isTerminal           = term.IsTerminal
+)
+
+/*
+ * missingArgs returns the required arguments of cmd that weren't given
+ */
+func missingArgs(cmd *cobra.Command, args []string) []usageArg {
+	required := requiredArgs(cmd.Use)
+	if len(args) >= len(required) {
+		return nil
+	}
+	return required[len(args):]
+}
+
+/*
+ * shouldPrompt tells whether sd should ask for missing arguments to cmd: it
+ * has to be asked to, by the --prompt flag, SD_PROMPT or a "# prompt: true"
+ * header, and be running in a terminal
+ */
+func shouldPrompt(cmd *cobra.Command) bool {
+	enabled, _ := strconv.ParseBool(env("SD_PROMPT"))
+	if f := cmd.Root().PersistentFlags().Lookup("prompt"); f != nil && f.Value.String() == "true" {
+		enabled = true
+	}
+	if cmd.Annotations["Prompt"] == "true" {
+		enabled = true
+	}
+	return enabled && isTerminal(int(os.Stdin.Fd())) && isTerminal(int(os.Stderr.Fd()))
+}
+
+/*
+ * promptable lets commands be run with missing required arguments when sd
+ * can prompt for them, which execCommand does before running the script
+ */
+func promptable(args cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, a []string) error {
+		err := args(cmd, a)
+		if err != nil && len(missingArgs(cmd, a)) > 0 && shouldPrompt(cmd) {
+			logrus.Debug("Prompting for missing arguments instead of: ", err)
+			return nil
+		}
+		return err
+	}
+}
+
+/*
+ * promptArgs asks for a value for each of args, one per line. Empty answers
+ * get the default, if there is one, and answers that aren't of the right type
+ * or one of the choices given for an argument get asked again.
+ */
+func promptArgs(r *bufio.Reader, w io.Writer, args []usageArg) ([]string, error) {
+	var values []string
+	for _, a := range args {
+		label := a.Name
+		if len(a.Choices) > 0 {
+			label += fmt.Sprintf(" (%s)", strings.Join(a.Choices, ", "))
+		} else if a.Type != "" {
+			label += fmt.Sprintf(" (%s)", a.Type)
+		}
+		if a.Default != "" {
+			label += fmt.Sprintf(" [%s]", a.Default)
+		}
+
+		for {
+			fmt.Fprintf(w, "%s: ", label)
+			line, err := r.ReadString('\n')
+			value := strings.TrimSpace(line)
+			if err != nil && (err != io.EOF || value == "") {
+				return nil, fmt.Errorf("no value given for %s", a.Name)
+			}
+			if value == "" {
+				value = a.Default
+			}
+			if value == "" {
+				continue
+			}
+			if err := a.check(value); err != nil {
+				fmt.Fprintln(w, err)
+				continue
+			}
+			values = append(values, value)
+			break
+		}
+	}
+	return values, nil
+}
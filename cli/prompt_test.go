@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/term"
+)
+
+func TestPromptArgs(t *testing.T) {
+	t.Run("asks for each", func(t *testing.T) {
+		var out bytes.Buffer
+		values, err := promptArgs(bufio.NewReader(strings.NewReader("prod\n\n web \n")), &out, []usageArg{{Name: "env"}, {Name: "svc"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"prod", "web"}, values)
+		assert.Equal(t, "env: svc: svc: ", out.String())
+	})
+
+	t.Run("uses defaults", func(t *testing.T) {
+		var out bytes.Buffer
+		values, err := promptArgs(bufio.NewReader(strings.NewReader("\n")), &out, []usageArg{{Name: "env", Default: "staging"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"staging"}, values)
+		assert.Equal(t, "env [staging]: ", out.String())
+	})
+
+	t.Run("insists on choices", func(t *testing.T) {
+		var out bytes.Buffer
+		values, err := promptArgs(bufio.NewReader(strings.NewReader("dev\nprod\n")), &out, []usageArg{{Name: "env", Choices: []string{"staging", "prod"}}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"prod"}, values)
+		assert.Equal(t, "env (staging, prod): invalid value \"dev\" for env, expected one of: staging, prod\nenv (staging, prod): ", out.String())
+	})
+
+	t.Run("insists on types", func(t *testing.T) {
+		var out bytes.Buffer
+		values, err := promptArgs(bufio.NewReader(strings.NewReader("two\n2\n")), &out, []usageArg{{Name: "replicas", Type: "int"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"2"}, values)
+		assert.Equal(t, "replicas (int): invalid value \"two\" for replicas, expected: int\nreplicas (int): ", out.String())
+	})
+
+	t.Run("fails without input", func(t *testing.T) {
+		_, err := promptArgs(bufio.NewReader(strings.NewReader("prod\n")), &bytes.Buffer{}, []usageArg{{Name: "env"}, {Name: "svc"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestShouldPrompt(t *testing.T) {
+	var tests = []struct {
+		name       string
+		flag       bool
+		envVar     string
+		annotation bool
+		terminal   bool
+		expected   bool
+	}{
+		{"off by default", false, "", false, true, false},
+		{"flag", true, "", false, true, true},
+		{"environment", false, "1", false, true, true},
+		{"header", false, "", true, true, true},
+		{"not in a terminal", true, "true", true, false, false},
+	}
+
+	defer func() {
+		env = os.Getenv
+		isTerminal = term.IsTerminal
+	}()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env = func(key string) string {
+				if key == "SD_PROMPT" {
+					return test.envVar
+				}
+				return ""
+			}
+			isTerminal = func(int) bool { return test.terminal }
+
+			s := &sd{root: &cobra.Command{}}
+			s.initPrompting()
+			if test.flag {
+				s.root.PersistentFlags().Set("prompt", "true")
+			}
+			cmd := &cobra.Command{Use: "foo", Annotations: map[string]string{}}
+			if test.annotation {
+				cmd.Annotations["Prompt"] = "true"
+			}
+			s.root.AddCommand(cmd)
+
+			assert.Equal(t, test.expected, shouldPrompt(cmd))
+		})
+	}
+}
+
+func TestPrompting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-prompting")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	script := writeScript(t, dir, "deploy", "#!/bin/sh\n# deploy: Deploys.\n# usage: deploy <env:staging|prod> <svc> [tag]\n# prompt: true\n")
+
+	defer func() {
+		syscallExec = syscall.Exec
+		isTerminal = term.IsTerminal
+		stdin = os.Stdin
+	}()
+
+	var argv []string
+	syscallExec = func(argv0 string, a []string, envv []string) error {
+		argv = a
+		return nil
+	}
+
+	run := func(terminal bool, input string, args ...string) error {
+		isTerminal = func(int) bool { return terminal }
+		stdin = strings.NewReader(input)
+		argv = nil
+
+		cmd, err := commandFromScript(script)
+		assert.NoError(t, err)
+
+		s := &sd{root: &cobra.Command{Use: "sd"}}
+		s.initEditing()
+		s.initRunner()
+		s.initPrompting()
+		s.root.AddCommand(cmd)
+		s.root.SetOut(ioutil.Discard)
+		s.root.SetErr(ioutil.Discard)
+		s.root.SetArgs(append([]string{"deploy"}, args...))
+		return s.root.Execute()
+	}
+
+	t.Run("asks for missing arguments", func(t *testing.T) {
+		assert.NoError(t, run(true, "prod\nweb\n"))
+		assert.Equal(t, []string{script, "prod", "web"}, argv)
+	})
+
+	t.Run("only asks for what's missing", func(t *testing.T) {
+		assert.NoError(t, run(true, "web\n", "staging"))
+		assert.Equal(t, []string{script, "staging", "web"}, argv)
+	})
+
+	t.Run("keeps the strict error without a terminal", func(t *testing.T) {
+		err := run(false, "prod\nweb\n", "staging")
+		assert.Equal(t, ExitUsage, ExitCode(err))
+		assert.Nil(t, argv)
+	})
+
+	t.Run("rejects invalid arguments instead of asking for more", func(t *testing.T) {
+		err := run(true, "web\n", "dev")
+		assert.Equal(t, ExitUsage, ExitCode(err))
+		assert.Nil(t, argv)
+	})
+
+	t.Run("still rejects too many arguments", func(t *testing.T) {
+		err := run(true, "", "a", "b", "c", "d")
+		assert.Equal(t, ExitUsage, ExitCode(err))
+		assert.Nil(t, argv)
+	})
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Ways of running scripts: replacing sd with them (the default), or as a child
+// process, which lets sd carry on doing things once they're done
+const (
+	runnerExec  = "exec"
+	runnerChild = "child"
+)
+
+// signals sd passes on to scripts running as child processes
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGWINCH, syscall.SIGHUP, syscall.SIGQUIT}
+
+/*
+ * runnerFor works out how to run the script behind cmd: the --runner flag
+ * wins over the "# runner:" header, and exec is the default
+ */
+func runnerFor(cmd *cobra.Command) (string, error) {
+	runner := cmd.Annotations["Runner"]
+	if f := cmd.Root().PersistentFlags().Lookup("runner"); f != nil && f.Value.String() != "" {
+		runner = f.Value.String()
+	}
+
+	switch runner {
+	case "":
+		return runnerExec, nil
+	case runnerExec, runnerChild:
+		return runner, nil
+	default:
+		return "", withCode(ExitUsage, fmt.Errorf("unknown runner %q, expected %q or %q", runner, runnerExec, runnerChild))
+	}
+}
+
+/*
+ * runChild runs path as a child process attached to sd's stdio, passing on
+ * signals sd gets while it runs, and returns its exit code
+ */
+func runChild(path string, args []string, env []string) (int, error) {
+	child := exec.Command(path, args...)
+	child.Env = env
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+
+	logrus.Debug("Starting child: ", path, " with args: ", args)
+	if err := child.Start(); err != nil {
+		return -1, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	done := make(chan struct{})
+	go forwardSignals(child.Process, signals, done)
+
+	err := child.Wait()
+	signal.Stop(signals)
+	close(done)
+
+	code, err := exitStatus(err)
+	logrus.Debug("Child ", path, " exited with: ", code)
+	return code, err
+}
+
+func forwardSignals(p *os.Process, signals <-chan os.Signal, done <-chan struct{}) {
+	for {
+		select {
+		case sig := <-signals:
+			logrus.Debug("Forwarding signal: ", sig)
+			if err := p.Signal(sig); err != nil {
+				logrus.Debug("Error forwarding signal: ", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+/*
+ * exitStatus turns what Wait returned into an exit code, following the shell
+ * convention of 128+n for processes killed by signal n
+ */
+func exitStatus(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return -1, err
+	}
+
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+		if status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return status.ExitStatus(), nil
+	}
+	return exitErr.ExitCode(), nil
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeScript(t *testing.T, dir string, name string, body string) string {
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(body), 0755))
+	return path
+}
+
+func TestRunnerFor(t *testing.T) {
+	var tests = []struct {
+		name       string
+		annotation string
+		flag       string
+		expected   string
+		err        bool
+	}{
+		{"defaults to exec", "", "", runnerExec, false},
+		{"from header", runnerChild, "", runnerChild, false},
+		{"flag wins over header", runnerChild, runnerExec, runnerExec, false},
+		{"from flag", "", runnerChild, runnerChild, false},
+		{"unknown", "", "fork", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sd := &sd{root: &cobra.Command{}}
+			sd.initRunner()
+			if test.flag != "" {
+				sd.root.PersistentFlags().Set("runner", test.flag)
+			}
+
+			cmd := &cobra.Command{Annotations: map[string]string{}}
+			if test.annotation != "" {
+				cmd.Annotations["Runner"] = test.annotation
+			}
+			sd.root.AddCommand(cmd)
+
+			runner, err := runnerFor(cmd)
+			if test.err {
+				assert.Equal(t, ExitUsage, ExitCode(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, runner)
+		})
+	}
+}
+
+func TestRunChild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-run-child")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("success", func(t *testing.T) {
+		path := writeScript(t, dir, "ok", "#!/bin/sh\nexit 0\n")
+		code, err := runChild(path, nil, os.Environ())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("passes exit codes through", func(t *testing.T) {
+		path := writeScript(t, dir, "fail", "#!/bin/sh\nexit 3\n")
+		code, err := runChild(path, nil, os.Environ())
+		assert.NoError(t, err)
+		assert.Equal(t, 3, code)
+	})
+
+	t.Run("passes args and environment", func(t *testing.T) {
+		out := filepath.Join(dir, "out")
+		path := writeScript(t, dir, "args", "#!/bin/sh\necho \"$1 $2 $FOO\" > \""+out+"\"\n")
+		code, err := runChild(path, []string{"one", "two"}, []string{"FOO=three"})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+
+		data, err := ioutil.ReadFile(out)
+		assert.NoError(t, err)
+		assert.Equal(t, "one two three\n", string(data))
+	})
+
+	t.Run("killed by a signal", func(t *testing.T) {
+		path := writeScript(t, dir, "killed", "#!/bin/sh\nkill -9 $$\n")
+		code, err := runChild(path, nil, os.Environ())
+		assert.NoError(t, err)
+		assert.Equal(t, 128+9, code)
+	})
+
+	t.Run("forwards signals", func(t *testing.T) {
+		ready := filepath.Join(dir, "ready")
+		path := writeScript(t, dir, "trap", "#!/bin/sh\ntrap 'exit 7' TERM\ntouch \""+ready+"\"\n"+
+			"i=0\nwhile [ $i -lt 100 ]; do sleep 0.1; i=$((i+1)); done\n")
+
+		go func() {
+			for i := 0; i < 100; i++ {
+				if _, err := os.Stat(ready); err == nil {
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		}()
+
+		code, err := runChild(path, nil, os.Environ())
+		assert.NoError(t, err)
+		assert.Equal(t, 7, code)
+	})
+
+	t.Run("missing script", func(t *testing.T) {
+		_, err := runChild(filepath.Join(dir, "nope"), nil, os.Environ())
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ANSI escapes used to highlight headers in sd show
+const (
+	ansiReset = "\x1b[0m"
+	ansiFaint = "\x1b[2m"
+	ansiKey   = "\x1b[1;36m"
+)
+
+func (s *sd) initShow() {
+	s.root.AddCommand(&cobra.Command{
+		Use:   "show command...",
+		Short: "Print the script behind a command",
+		Long: `Print the script behind a command, with its header highlighted when printing
+to a terminal. For directories, their README is printed instead.`,
+		Example: "  sd show deploy prod",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := findCommand(cmd.Root(), args)
+			if err != nil {
+				return err
+			}
+
+			path := target.Annotations["Source"]
+			if isDir(target) {
+				path = filepath.Join(path, "README")
+			}
+			return showScript(cmd.OutOrStdout(), path, useColor(cmd.OutOrStdout()))
+		},
+	})
+}
+
+/*
+ * useColor tells whether w is a terminal that should get colored output
+ */
+func useColor(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || env("NO_COLOR") != "" || env("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+/*
+ * showScript copies the file at path to w, highlighting the keys in its
+ * header and dimming the rest of the comments in it if color is set
+ */
+func showScript(w io.Writer, path string, color bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var style *commentStyle
+	inHeader := color
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inHeader {
+			line, inHeader = highlight(line, &style, filepath.Base(path))
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+/*
+ * highlight colors a line in the header of a script, and tells whether the
+ * header carries on past it
+ */
+func highlight(line string, style **commentStyle, name string) (string, bool) {
+	if strings.TrimSpace(line) == "" {
+		return line, true
+	}
+
+	if *style == nil {
+		*style = detectCommentStyle(line)
+		if strings.HasPrefix(line, "#!") {
+			return ansiFaint + line + ansiReset, true
+		}
+	}
+
+	uncommented, ok := (*style).uncomment(line)
+	if !ok {
+		return line, false
+	}
+
+	key, _, ok := headerKey(name, uncommented)
+	i := strings.Index(line, key+": ")
+	if !ok || i < 0 {
+		return ansiFaint + line + ansiReset, true
+	}
+
+	end := i + len(key) + 1
+	return ansiFaint + line[:i] + ansiReset + ansiKey + line[i:end] + ansiReset + line[end:], true
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShowScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-show")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	body := "#!/usr/bin/env node\n// bar: Bars.\n// usage: bar <env>\n// More about it.\n\nconsole.log('# usage: not a header')\n"
+	path := writeScript(t, dir, "bar", body)
+
+	t.Run("plain", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, showScript(&out, path, false))
+		assert.Equal(t, body, out.String())
+	})
+
+	t.Run("highlighted", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, showScript(&out, path, true))
+		assert.Equal(t, ansiFaint+"#!/usr/bin/env node"+ansiReset+"\n"+
+			ansiFaint+"// "+ansiReset+ansiKey+"bar:"+ansiReset+" Bars.\n"+
+			ansiFaint+"// "+ansiReset+ansiKey+"usage:"+ansiReset+" bar <env>\n"+
+			ansiFaint+"// More about it."+ansiReset+"\n"+
+			"\n"+
+			"console.log('# usage: not a header')\n", out.String())
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		assert.Error(t, showScript(&bytes.Buffer{}, dir+"/nope", false))
+	})
+}
+
+func TestUseColor(t *testing.T) {
+	assert.False(t, useColor(&bytes.Buffer{}))
+
+	f, err := ioutil.TempFile("", "test-use-color")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	assert.False(t, useColor(f))
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// types positional arguments can be declared as, and how to check them
+var argTypes = map[string]func(string) error{
+	"int": func(value string) error {
+		_, err := strconv.Atoi(value)
+		return err
+	},
+	"float": func(value string) error {
+		_, err := strconv.ParseFloat(value, 64)
+		return err
+	},
+}
+
+// usageArg is a positional argument in a usage line, like "<env:staging|prod>",
+// "<replicas:int>", "[tag=latest]" or just "name"
+type usageArg struct {
+	Name     string
+	Optional bool
+	Type     string
+	Default  string
+	Choices  []string
+}
+
+/*
+ * parseUsageArg reads an argument from a usage line: its name, optionally
+ * followed by ":" and either its type or the values it can take separated
+ * by "|", and then by "=" and its default. Arguments in brackets are optional.
+ * Only arguments in "<>" or "[]" are read that way; anything else, like
+ * "host:path", is just a name.
+ */
+func parseUsageArg(token string) usageArg {
+	a := usageArg{Name: token}
+	switch {
+	case strings.HasPrefix(token, "[") && strings.HasSuffix(token, "]"):
+		a.Optional = true
+		token = token[1 : len(token)-1]
+	case !strings.HasPrefix(token, "<") || !strings.HasSuffix(token, ">"):
+		return a
+	}
+	token = strings.NewReplacer("<", "", ">", "").Replace(token)
+
+	if i := strings.Index(token, "="); i >= 0 {
+		token, a.Default = token[:i], token[i+1:]
+	}
+	if i := strings.Index(token, ":"); i >= 0 {
+		kind := token[i+1:]
+		if _, ok := argTypes[kind]; ok {
+			a.Type = kind
+		} else {
+			a.Choices = strings.Split(kind, "|")
+		}
+		token = token[:i]
+	}
+	a.Name = token
+	return a
+}
+
+// usageFields splits a usage line into the command's name and its arguments
+func usageFields(usage string) []string {
+	return strings.Fields(usage)
+}
+
+/*
+ * positionalArgs returns the arguments in a usage line, and whether the last
+ * of them can be repeated, as in "foo arg ..."
+ */
+func positionalArgs(usage string) ([]usageArg, bool) {
+	fields := usageFields(usage)
+	if len(fields) < 2 {
+		return nil, false
+	}
+
+	var args []usageArg
+	variadic := false
+	for _, token := range fields[1:] {
+		if token == "..." {
+			variadic = true
+			continue
+		}
+		args = append(args, parseUsageArg(token))
+	}
+	return args, variadic && len(args) > 0
+}
+
+/*
+ * requiredArgs returns the required arguments in a usage line
+ */
+func requiredArgs(usage string) []usageArg {
+	args, _ := positionalArgs(usage)
+
+	var required []usageArg
+	for _, a := range args {
+		if !a.Optional {
+			required = append(required, a)
+		}
+	}
+	return required
+}
+
+/*
+ * defaultArgs returns the defaults of the arguments in a usage line that come
+ * after the ones given, up to the first one without a default
+ */
+func defaultArgs(usage string, given []string) []string {
+	args, _ := positionalArgs(usage)
+
+	var defaults []string
+	for i := len(given); i < len(args) && args[i].Default != ""; i++ {
+		defaults = append(defaults, args[i].Default)
+	}
+	return defaults
+}
+
+// argAt returns the argument declared for position i, if there is one
+func argAt(args []usageArg, variadic bool, i int) (usageArg, bool) {
+	switch {
+	case i < len(args):
+		return args[i], true
+	case variadic:
+		return args[len(args)-1], true
+	default:
+		return usageArg{}, false
+	}
+}
+
+/*
+ * check tells whether value is of the argument's type and one of its choices
+ */
+func (a usageArg) check(value string) error {
+	if len(a.Choices) > 0 && !containsString(a.Choices, value) {
+		return fmt.Errorf("invalid value %q for %s, expected one of: %s", value, a.Name, strings.Join(a.Choices, ", "))
+	}
+	if check, ok := argTypes[a.Type]; ok && check(value) != nil {
+		return fmt.Errorf("invalid value %q for %s, expected: %s", value, a.Name, a.Type)
+	}
+	return nil
+}
+
+/*
+ * checkedArgs checks the types and choices of the arguments given to a
+ * command against its usage line, before leaving it to args to check how
+ * many there are
+ */
+func checkedArgs(args cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, a []string) error {
+		declared, variadic := positionalArgs(cmd.Use)
+		for i, value := range a {
+			if arg, ok := argAt(declared, variadic, i); ok {
+				if err := arg.check(value); err != nil {
+					return err
+				}
+			}
+		}
+		return args(cmd, a)
+	}
+}
+
+/*
+ * completeArgs completes the argument being typed from its choices, if the
+ * usage line lists any, or from the script's completion hook otherwise
+ */
+func completeArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	declared, variadic := positionalArgs(cmd.Use)
+	arg, ok := argAt(declared, variadic, len(args))
+	switch {
+	case len(arg.Choices) == 0 && cmd.Annotations["Complete"] != "":
+		return completeFromHook(cmd, args, toComplete)
+	case !ok || (len(arg.Choices) == 0 && arg.Type == ""):
+		return nil, cobra.ShellCompDirectiveDefault
+	case len(arg.Choices) == 0:
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var choices []string
+	for _, c := range arg.Choices {
+		if strings.HasPrefix(c, toComplete) {
+			choices = append(choices, c)
+		}
+	}
+	return choices, cobra.ShellCompDirectiveNoFileComp
+}
+
+/*
+ * argUsages formats the arguments in a command's usage line for its help,
+ * lined up like cobra does with flags. It's empty unless at least one of
+ * them has a type, choices or a default worth showing.
+ */
+func argUsages(cmd *cobra.Command) string {
+	args, _ := positionalArgs(cmd.Use)
+
+	width, documented := 0, false
+	for _, a := range args {
+		if len(a.Name) > width {
+			width = len(a.Name)
+		}
+		if a.Type != "" || len(a.Choices) > 0 || a.Default != "" {
+			documented = true
+		}
+	}
+	if !documented {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, a := range args {
+		desc := a.Type
+		if len(a.Choices) > 0 {
+			desc = "one of: " + strings.Join(a.Choices, ", ")
+		}
+		if a.Optional {
+			desc = strings.TrimSpace(desc + " (optional)")
+		}
+		if a.Default != "" {
+			desc = strings.TrimSpace(fmt.Sprintf("%s (default %q)", desc, a.Default))
+		}
+		fmt.Fprintf(&b, "  %-*s   %s\n", width, a.Name, desc)
+	}
+	return b.String()
+}
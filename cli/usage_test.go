@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUsageArg(t *testing.T) {
+	var tests = []struct {
+		token    string
+		expected usageArg
+	}{
+		{"env", usageArg{Name: "env"}},
+		{"<env>", usageArg{Name: "env"}},
+		{"[tag]", usageArg{Name: "tag", Optional: true}},
+		{"[<tag>=latest]", usageArg{Name: "tag", Optional: true, Default: "latest"}},
+		{"<env:staging|prod>", usageArg{Name: "env", Choices: []string{"staging", "prod"}}},
+		{"<env:staging|prod=staging>", usageArg{Name: "env", Choices: []string{"staging", "prod"}, Default: "staging"}},
+		{"<replicas:int>", usageArg{Name: "replicas", Type: "int"}},
+		{"[ratio:float=0.5]", usageArg{Name: "ratio", Optional: true, Type: "float", Default: "0.5"}},
+		{"<env:prod>", usageArg{Name: "env", Choices: []string{"prod"}}},
+		{"host:path", usageArg{Name: "host:path"}},
+		{"name=value", usageArg{Name: "name=value"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.token, func(t *testing.T) {
+			assert.Equal(t, test.expected, parseUsageArg(test.token))
+		})
+	}
+}
+
+func TestPositionalArgs(t *testing.T) {
+	args, variadic := positionalArgs("")
+	assert.Empty(t, args)
+	assert.False(t, variadic)
+
+	args, variadic = positionalArgs("deploy <env> [tag] ...")
+	assert.Equal(t, []usageArg{{Name: "env"}, {Name: "tag", Optional: true}}, args)
+	assert.True(t, variadic)
+
+	args, variadic = positionalArgs("deploy  <env>   [tag]")
+	assert.Equal(t, []usageArg{{Name: "env"}, {Name: "tag", Optional: true}}, args)
+	assert.False(t, variadic)
+}
+
+func TestRequiredArgs(t *testing.T) {
+	assert.Empty(t, requiredArgs("web"))
+	assert.Equal(t, []usageArg{{Name: "env"}, {Name: "svc"}}, requiredArgs("web <env> svc [tag] ..."))
+}
+
+func TestDefaultArgs(t *testing.T) {
+	assert.Empty(t, defaultArgs("deploy <env> [tag]", []string{"prod"}))
+	assert.Equal(t, []string{"latest"}, defaultArgs("deploy <env> [tag=latest]", []string{"prod"}))
+	assert.Empty(t, defaultArgs("deploy <env> [tag=latest]", []string{"prod", "v1"}))
+	assert.Equal(t, []string{"1", "latest"}, defaultArgs("deploy <env> [n:int=1] [tag=latest] ...", []string{"prod"}))
+	assert.Equal(t, []string{"1"}, defaultArgs("deploy <env> [n:int=1] [tag] [other=x]", []string{"prod"}))
+}
+
+func TestCheckedArgs(t *testing.T) {
+	var tests = []struct {
+		name string
+		use  string
+		args []string
+		ok   bool
+	}{
+		{"valid", "deploy <env:staging|prod> <replicas:int> [tag]", []string{"prod", "3", "v1"}, true},
+		{"bad choice", "deploy <env:staging|prod> <replicas:int> [tag]", []string{"dev", "3"}, false},
+		{"bad type", "deploy <env:staging|prod> <replicas:int> [tag]", []string{"prod", "three"}, false},
+		{"checks given args before counting", "deploy <env:staging|prod> <replicas:int>", []string{"dev"}, false},
+		{"repeats the last", "scale <replicas:int> ...", []string{"1", "2", "x"}, false},
+		{"anything without a usage line", "anything", []string{"a", "b"}, true},
+		{"bare names aren't typed", "push host:path", []string{"example.com:/tmp"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			called := false
+			check := checkedArgs(func(*cobra.Command, []string) error {
+				called = true
+				return nil
+			})
+
+			err := check(&cobra.Command{Use: test.use}, test.args)
+			assert.Equal(t, test.ok, err == nil)
+			assert.Equal(t, test.ok, called)
+		})
+	}
+}
+
+func TestCompleteArgs(t *testing.T) {
+	cmd := &cobra.Command{Use: "deploy <env:staging|prod|preview> <replicas:int> [tag]"}
+
+	choices, directive := completeArgs(cmd, nil, "")
+	assert.Equal(t, []string{"staging", "prod", "preview"}, choices)
+	assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+
+	choices, _ = completeArgs(cmd, nil, "pr")
+	assert.Equal(t, []string{"prod", "preview"}, choices)
+
+	choices, directive = completeArgs(cmd, []string{"prod"}, "")
+	assert.Empty(t, choices)
+	assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+
+	choices, directive = completeArgs(cmd, []string{"prod", "3"}, "")
+	assert.Empty(t, choices)
+	assert.Equal(t, cobra.ShellCompDirectiveDefault, directive)
+}
+
+func TestArgUsages(t *testing.T) {
+	assert.Equal(t, "", argUsages(&cobra.Command{Use: "deploy <env> [tag]"}))
+	assert.Equal(t, "", argUsages(&cobra.Command{Use: "new command..."}))
+
+	assert.Equal(t,
+		"  env        one of: staging, prod (default \"staging\")\n"+
+			"  replicas   int\n"+
+			"  tag        (optional)\n",
+		argUsages(&cobra.Command{Use: "deploy <env:staging|prod=staging> <replicas:int> [tag]"}))
+}
@@ -1,5 +1,22 @@
 package cli
 
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// containsString tells whether s is one of items
+func containsString(items []string, s string) bool {
+	for _, i := range items {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
 /*
  * deduplicate a slice of strings, keeping the order of the elements
  */
@@ -17,3 +34,103 @@ func deduplicate(input []string) []string {
 	}
 	return output
 }
+
+/*
+ * contains tells whether any of the items is named name
+ */
+func contains(items []os.FileInfo, name string) bool {
+	for _, i := range items {
+		if i.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * trimBlankLines joins lines, leaving out blank ones at the start and the end
+ */
+func trimBlankLines(lines []string) string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+ * dirsBetween returns every directory from root down to the one the file at
+ * path is in, outermost first, or nothing if path isn't under root
+ */
+func dirsBetween(root string, path string) []string {
+	if root == "" || path == "" {
+		return nil
+	}
+
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+
+	dirs := []string{root}
+	if rel == "." {
+		return dirs
+	}
+
+	dir := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+/*
+ * writeFileAtomic writes data to a temporary file next to path first, and
+ * then moves it in place, so concurrent runs never see half a file
+ */
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+/*
+ * mergeEnv removes duplicate variables from an environment, the last one
+ * winning, while keeping the order they first appeared in
+ */
+func mergeEnv(environ []string) []string {
+	var out []string
+	index := map[string]int{}
+	for _, kv := range environ {
+		name := kv
+		if i := strings.Index(kv, "="); i >= 0 {
+			name = kv[:i]
+		}
+		if i, ok := index[name]; ok {
+			out[i] = kv
+			continue
+		}
+		index[name] = len(out)
+		out = append(out, kv)
+	}
+	return out
+}
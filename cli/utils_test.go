@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -41,3 +44,47 @@ func TestDeduplicate(t *testing.T) {
 		})
 	}
 }
+
+func TestTrimBlankLines(t *testing.T) {
+	assert.Equal(t, "", trimBlankLines(nil))
+	assert.Equal(t, "", trimBlankLines([]string{"", " "}))
+	assert.Equal(t, "a\n\nb", trimBlankLines([]string{"", "a", "", "b", " ", ""}))
+}
+
+func TestDirsBetween(t *testing.T) {
+	assert.Equal(t, []string{"/a"}, dirsBetween("/a", "/a/script"))
+	assert.Equal(t, []string{"/a", "/a/b", "/a/b/c"}, dirsBetween("/a", "/a/b/c/script"))
+	assert.Empty(t, dirsBetween("/a/b", "/a/script"))
+	assert.Empty(t, dirsBetween("", "/a/script"))
+	assert.Equal(t, []string{"/a", "/a/..b"}, dirsBetween("/a", "/a/..b/script"))
+}
+
+func TestMergeEnv(t *testing.T) {
+	assert.Equal(t,
+		[]string{"A=3", "B=2", "C=4"},
+		mergeEnv([]string{"A=1", "B=2", "A=3", "C=4"}))
+}
+
+func TestContainsString(t *testing.T) {
+	assert.True(t, containsString([]string{"a", "b"}, "b"))
+	assert.False(t, containsString([]string{"a", "b"}, "c"))
+	assert.False(t, containsString(nil, ""))
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-write-file-atomic")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a", "b", "file")
+	assert.NoError(t, writeFileAtomic(path, []byte("one")))
+	assert.NoError(t, writeFileAtomic(path, []byte("two")))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "two", string(data))
+
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
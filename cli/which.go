@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+func (s *sd) initWhich() {
+	s.root.AddCommand(&cobra.Command{
+		Use:   "which command...",
+		Short: "Show where a command comes from",
+		Long: `Show the path to the script or directory behind a command, followed by the
+source it was loaded from and any others with the same name it shadows.`,
+		Example: "  sd which deploy prod",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := findCommand(cmd.Root(), args)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), absPath(target.Annotations["Source"]))
+			fmt.Fprintf(cmd.OutOrStdout(), "  from %s\n", absPath(target.Annotations["Root"]))
+			for _, path := range shadowedBy(target) {
+				fmt.Fprintf(cmd.OutOrStdout(), "  shadows %s\n", path)
+			}
+			return nil
+		},
+	})
+}
+
+/*
+ * findCommand returns the command loaded from a script or directory at the
+ * given path in the tree
+ */
+func findCommand(root *cobra.Command, path []string) (*cobra.Command, error) {
+	target, rest, err := root.Find(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unknown command %q for %q", rest[0], target.CommandPath())
+	}
+	if target.Annotations["Source"] == "" {
+		return nil, fmt.Errorf("%q is built into %s", target.CommandPath(), root.Name())
+	}
+	return target, nil
+}
+
+// absPath makes path absolute, if it can, as sources in SD_PATH may not be
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhich(t *testing.T) {
+	var tests = []struct {
+		name     string
+		args     []string
+		expected string
+		err      int
+	}{
+		{"script", []string{"which", "deploy", "web"}, "/project/deploy/web\n  from /project\n  shadows /home/deploy/web\n", ExitOK},
+		{"directory", []string{"which", "deploy"}, "/project/deploy\n  from /project\n", ExitOK},
+		{"built-in", []string{"which", "which"}, "", ExitFailure},
+		{"unknown", []string{"which", "nope"}, "", ExitUnknownCommand},
+		{"past a script", []string{"which", "deploy", "web", "nope"}, "", ExitUnknownCommand},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &sd{root: &cobra.Command{Use: "sd"}}
+			s.initWhich()
+
+			deploy := &cobra.Command{Use: "deploy [command]", Annotations: map[string]string{"Source": "/project/deploy", "Root": "/project", "Dir": "true"}}
+			deploy.AddCommand(&cobra.Command{
+				Use:         "web",
+				Annotations: map[string]string{"Source": "/project/deploy/web", "Root": "/project", "Shadows": "/home/deploy/web"},
+				RunE:        execCommand,
+			})
+			s.root.AddCommand(deploy)
+
+			var out bytes.Buffer
+			s.root.SetOut(&out)
+			s.root.SetErr(&bytes.Buffer{})
+			s.root.SetArgs(test.args)
+
+			err := s.root.Execute()
+			assert.Equal(t, test.err, ExitCode(classify(err)))
+			if err == nil {
+				assert.Equal(t, test.expected, out.String())
+			}
+		})
+	}
+}
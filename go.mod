@@ -6,8 +6,10 @@ require (
 	github.com/Sirupsen/logrus v1.0.6
 	github.com/sirupsen/logrus v1.8.1 // indirect
 	github.com/spf13/cobra v1.8.0
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.2.2
 	golang.org/x/crypto v0.21.0 // indirect
+	golang.org/x/term v0.18.0
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
 )
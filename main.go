@@ -14,7 +14,5 @@ var (
 func main() {
 	sd := cli.New(version)
 	err := sd.Run()
-	if err != nil {
-		os.Exit(-1)
-	}
+	os.Exit(cli.ExitCode(err))
 }